@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hami-Lemon/bobo-bot/analyse"
+	"github.com/Hami-Lemon/bobo-bot/logger"
+)
+
+// Admin 运行时管理 bot 的 http 接口，所有请求都需要在请求头中携带 Authorization: Bearer <token>
+type Admin struct {
+	token  string
+	group  *BotGroup
+	exit   func() //停止所有的 bot
+	server *http.Server
+	logger *logger.Logger
+}
+
+// BotStatus bot 的运行状态
+type BotStatus struct {
+	Name     string      `json:"name"`     //评论区名称
+	Oid      uint64      `json:"oid"`      //评论区oid
+	Login    bool        `json:"login"`    //bot 账号的登录状态是否有效
+	Like     bool        `json:"like"`     //是否点赞
+	Post     bool        `json:"post"`     //是否发布数据总结动态
+	Queue    int         `json:"queue"`    //点赞任务队列中的评论数
+	QueueCap int         `json:"queueCap"` //点赞任务队列的容量
+	Fetch    FetchStatus `json:"fetch"`    //最近一次获取评论的情况
+}
+
+// NewAdmin 创建管理接口，addr 为监听的地址，token 为访问接口所需的令牌
+func NewAdmin(addr, token string, group *BotGroup, exit func()) *Admin {
+	a := &Admin{
+		token:  token,
+		group:  group,
+		exit:   exit,
+		logger: logger.New("Admin", logLevel, logDst),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", a.auth(http.MethodGet, a.status))
+	mux.HandleFunc("/counter", a.auth(http.MethodGet, a.counter))
+	mux.HandleFunc("/like", a.auth(http.MethodPost, a.toggle((*Bot).SetLike)))
+	mux.HandleFunc("/post", a.auth(http.MethodPost, a.toggle((*Bot).SetPost)))
+	mux.HandleFunc("/summarize", a.auth(http.MethodPost, a.summarize))
+	mux.HandleFunc("/stop", a.auth(http.MethodPost, a.stop))
+	a.server = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return a
+}
+
+// Start 开始监听
+func (a *Admin) Start() {
+	go func() {
+		a.logger.Info("管理接口监听：%s", a.server.Addr)
+		err := a.server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			a.logger.Error("管理接口启动失败，%v", err)
+		}
+	}()
+}
+
+// Stop 停止监听
+func (a *Admin) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_ = a.server.Shutdown(ctx)
+}
+
+//校验请求方法和令牌
+func (a *Admin) auth(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		//只接受 Bearer 类型的令牌
+		header := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(header, "Bearer ")
+		if !strings.HasPrefix(header, "Bearer ") || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			a.logger.Warn("令牌错误，remote=%s, path=%s", r.RemoteAddr, r.URL.Path)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		a.logger.Debug("%s %s, remote=%s", r.Method, r.URL.String(), r.RemoteAddr)
+		h(w, r)
+	}
+}
+
+//根据请求参数 board 选择 bot，参数为空时选择所有的 bot
+func (a *Admin) selectBots(w http.ResponseWriter, r *http.Request) ([]*Bot, bool) {
+	name := r.URL.Query().Get("board")
+	bots := a.group.All()
+	if name == "" {
+		return bots, true
+	}
+	for _, bot := range bots {
+		if bot.board.name == name {
+			return []*Bot{bot}, true
+		}
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"error": "board not found"})
+	return nil, false
+}
+
+//GET /status?board=name 获取 bot 的运行状态
+func (a *Admin) status(w http.ResponseWriter, r *http.Request) {
+	bots, ok := a.selectBots(w, r)
+	if !ok {
+		return
+	}
+	status := make([]BotStatus, 0, len(bots))
+	for _, bot := range bots {
+		status = append(status, BotStatus{
+			Name:     bot.board.name,
+			Oid:      bot.board.oid,
+			Login:    bot.bili.LoggedIn(),
+			Like:     bot.Liking(),
+			Post:     bot.Posting(),
+			Queue:    len(bot.likeQueue),
+			QueueCap: cap(bot.likeQueue),
+			Fetch:    bot.Fetch(),
+		})
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+//GET /counter?board=name 获取统计器的当前数据
+func (a *Admin) counter(w http.ResponseWriter, r *http.Request) {
+	bots, ok := a.selectBots(w, r)
+	if !ok {
+		return
+	}
+	summaries := make([]analyse.Summary, 0, len(bots))
+	for _, bot := range bots {
+		bot.counter.lock.Lock()
+		summary := bot.snapshot()
+		//统计器中的数据会继续修改，序列化之前不能释放锁
+		data, _ := json.Marshal(summary)
+		bot.counter.lock.Unlock()
+		summary = analyse.Summary{}
+		_ = json.Unmarshal(data, &summary)
+		summaries = append(summaries, summary)
+	}
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+//POST /like?board=name&on=true 开启或关闭点赞，/post 同理
+func (a *Admin) toggle(set func(*Bot, bool)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		on, err := strconv.ParseBool(r.URL.Query().Get("on"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid param on"})
+			return
+		}
+		bots, ok := a.selectBots(w, r)
+		if !ok {
+			return
+		}
+		for _, bot := range bots {
+			set(bot, on)
+			a.logger.Info("%s %s：%v", bot.board.name, r.URL.Path, on)
+		}
+		a.status(w, r)
+	}
+}
+
+//POST /summarize?board=name 立即汇总数据
+func (a *Admin) summarize(w http.ResponseWriter, r *http.Request) {
+	bots, ok := a.selectBots(w, r)
+	if !ok {
+		return
+	}
+	files := make([]string, 0, len(bots))
+	for _, bot := range bots {
+		fileName := bot.Summarize()
+		if strings.Compare("", fileName) != 0 {
+			go bot.ReportSummarize(fileName)
+			files = append(files, fileName)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"files": files})
+}
+
+//POST /stop 停止所有的 bot，程序随后退出
+func (a *Admin) stop(w http.ResponseWriter, _ *http.Request) {
+	a.logger.Info("通过管理接口停止赛博监控")
+	writeJSON(w, http.StatusOK, map[string]string{"status": "stopping"})
+	go a.exit()
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAuth(t *testing.T) {
+	a := NewAdmin("", "secret", &BotGroup{}, func() {})
+	for _, c := range []struct {
+		header string
+		code   int
+	}{
+		{"Bearer secret", http.StatusOK},
+		{"", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized}, //没有 Bearer 前缀
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Basic secret", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/status", nil)
+		if c.header != "" {
+			r.Header.Set("Authorization", c.header)
+		}
+		w := httptest.NewRecorder()
+		a.server.Handler.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Errorf("Authorization: %q got: %d, except: %d", c.header, w.Code, c.code)
+		}
+	}
+}
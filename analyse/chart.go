@@ -0,0 +1,395 @@
+package analyse
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/bitmapfont/v3"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Format 图片格式
+type Format string
+
+const (
+	JPEG Format = "jpg"
+	PNG  Format = "png"
+	SVG  Format = "svg"
+)
+
+// ErrFormat 不支持的图片格式
+var ErrFormat = errors.New("unsupported image format")
+
+//图片大小以及绘图区域的边距，单位：像素
+const (
+	width        = 1600
+	height       = 900
+	marginLeft   = 140
+	marginRight  = 60
+	marginTop    = 100
+	marginBottom = 140
+	textScale    = 2 //位图中文字的放大倍数
+)
+
+var (
+	bgColor   = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	plotColor = color.RGBA{R: 0xea, G: 0xea, B: 0xf2, A: 0xff} //绘图区域的背景色
+	gridColor = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	lineColor = color.RGBA{R: 0x4c, G: 0x72, B: 0xb0, A: 0xff}
+	fillColor = color.RGBA{R: 0x87, G: 0xce, B: 0xeb, A: 0xff} //折线下方区域的颜色，绘制时使用 fillAlpha 的透明度
+	textColor = color.RGBA{R: 0x26, G: 0x26, B: 0x26, A: 0xff}
+	fillAlpha = 0.4
+)
+
+//颜色的十六进制表示，用于 svg
+func colorToHex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+//格式化时间戳
+func unixFormat(t int64, layout string) string {
+	return time.Unix(t, 0).Format(layout)
+}
+
+// Chart 折线图或柱状图
+type Chart struct {
+	Title  string    //标题
+	XLabel string    //x轴名称
+	YLabel string    //y轴名称
+	X      []string  //x轴上每个点的标签
+	Y      []float64 //每个点的值
+	Bar    bool      //是否为柱状图
+	Fill   bool      //折线图是否填充折线下方的区域
+}
+
+//图表的布局，位图和 svg 共用
+type layout struct {
+	n       int       //数据点个数
+	yTicks  []float64 //y轴刻度
+	xStep   int       //每隔 xStep 个点显示一个x轴标签
+	cell    float64   //每个数据点占据的宽度
+	plotW   float64
+	plotH   float64
+	yMin    float64
+	yMax    float64
+	yLabels []string
+}
+
+func newLayout(c *Chart) *layout {
+	l := &layout{
+		n:     len(c.Y),
+		xStep: 1,
+		plotW: width - marginLeft - marginRight,
+		plotH: height - marginTop - marginBottom,
+	}
+	//x轴最多显示24个标签
+	if l.n > 24 {
+		l.xStep = int(math.Ceil(float64(l.n) / 24))
+	}
+	if l.n > 0 {
+		l.cell = l.plotW / float64(l.n)
+	}
+	//y轴的范围和刻度，最多15个刻度
+	yMin, yMax := 0.0, 0.0
+	for i, y := range c.Y {
+		if i == 0 || y < yMin {
+			yMin = y
+		}
+		if i == 0 || y > yMax {
+			yMax = y
+		}
+	}
+	yMax += 10
+	if yMin < 50 {
+		yMin = 0
+	}
+	step := 1.0
+	if yMax-yMin > 15 {
+		step = math.Ceil((yMax - yMin) / 15)
+	}
+	for v := yMin; v < math.Floor(yMax+step); v += step {
+		l.yTicks = append(l.yTicks, v)
+		l.yLabels = append(l.yLabels, strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64))
+	}
+	l.yMin = yMin
+	l.yMax = l.yTicks[len(l.yTicks)-1]
+	if l.yMax <= l.yMin {
+		l.yMax = l.yMin + 1
+	}
+	return l
+}
+
+//数据点 i 对应的x坐标
+func (l *layout) x(i int) float64 {
+	return marginLeft + l.cell*(float64(i)+0.5)
+}
+
+//值 v 对应的y坐标
+func (l *layout) y(v float64) float64 {
+	return marginTop + l.plotH*(1-(v-l.yMin)/(l.yMax-l.yMin))
+}
+
+// Save 将图表保存为文件
+func (c *Chart) Save(fileName string, format Format) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	switch format {
+	case SVG:
+		err = c.WriteSVG(w)
+	case PNG:
+		err = png.Encode(w, c.Image())
+	case JPEG:
+		err = jpeg.Encode(w, c.Image(), &jpeg.Options{Quality: 90})
+	default:
+		err = ErrFormat
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// WriteSVG 将图表绘制为 svg
+func (c *Chart) WriteSVG(w io.Writer) error {
+	l := newLayout(c)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="SimHei, Microsoft YaHei, sans-serif">`,
+		width, height, width, height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="%s"/>`, width, height, colorToHex(bgColor))
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%.1f" fill="%s"/>`,
+		marginLeft, marginTop, l.plotW, l.plotH, colorToHex(plotColor))
+	//y轴刻度和网格线
+	for i, v := range l.yTicks {
+		y := l.y(v)
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`,
+			marginLeft, y, marginLeft+l.plotW, y, colorToHex(gridColor))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" font-size="20" text-anchor="end" dominant-baseline="middle" fill="%s">%s</text>`,
+			marginLeft-10, y, colorToHex(textColor), l.yLabels[i])
+	}
+	//x轴标签
+	for i := 0; i < l.n && i < len(c.X); i += l.xStep {
+		x := l.x(i)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" font-size="20" text-anchor="end" transform="rotate(-33 %.1f %d)" fill="%s">%s</text>`,
+			x, marginTop+int(l.plotH)+30, x, marginTop+int(l.plotH)+30, colorToHex(textColor), html.EscapeString(c.X[i]))
+	}
+	base := l.y(l.yMin)
+	if c.Bar {
+		for i, v := range c.Y {
+			y := l.y(v)
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`,
+				l.x(i)-l.cell*0.4, y, l.cell*0.8, base-y, colorToHex(lineColor))
+		}
+	} else if l.n > 0 {
+		points := make([]string, 0, l.n)
+		for i, v := range c.Y {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", l.x(i), l.y(v)))
+		}
+		if c.Fill {
+			fmt.Fprintf(&b, `<polygon points="%.1f,%.1f %s %.1f,%.1f" fill="%s" fill-opacity="%.1f"/>`,
+				l.x(0), base, strings.Join(points, " "), l.x(l.n-1), base, colorToHex(fillColor), fillAlpha)
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="3"/>`,
+			strings.Join(points, " "), colorToHex(lineColor))
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="32" text-anchor="middle" fill="%s">%s</text>`,
+		width/2, marginTop/2+10, colorToHex(textColor), html.EscapeString(c.Title))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="24" text-anchor="middle" fill="%s">%s</text>`,
+		marginLeft+int(l.plotW)/2, height-20, colorToHex(textColor), html.EscapeString(c.XLabel))
+	fmt.Fprintf(&b, `<text x="30" y="%d" font-size="24" text-anchor="middle" transform="rotate(-90 30 %d)" fill="%s">%s</text>`,
+		marginTop+int(l.plotH)/2, marginTop+int(l.plotH)/2, colorToHex(textColor), html.EscapeString(c.YLabel))
+	b.WriteString("</svg>")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Image 将图表绘制为位图，文字使用内置的 12px 点阵中文字体
+func (c *Chart) Image() image.Image {
+	l := newLayout(c)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bgColor), image.Point{}, draw.Src)
+	plot := image.Rect(marginLeft, marginTop, marginLeft+int(l.plotW), marginTop+int(l.plotH))
+	draw.Draw(img, plot, image.NewUniform(plotColor), image.Point{}, draw.Src)
+	//y轴刻度和网格线
+	for i, v := range l.yTicks {
+		y := int(l.y(v))
+		draw.Draw(img, image.Rect(plot.Min.X, y-1, plot.Max.X, y+1), image.NewUniform(gridColor), image.Point{}, draw.Src)
+		drawText(img, l.yLabels[i], marginLeft-10, y, alignRight)
+	}
+	//x轴标签，位图中的标签不旋转，根据标签的宽度调整间隔，避免相互重叠
+	xStep := l.xStep
+	if l.n > 0 && len(c.X) > 0 {
+		labelW := float64(font.MeasureString(textFace, c.X[0]).Ceil()*textScale + 20)
+		if step := int(math.Ceil(labelW / l.cell)); step > xStep {
+			xStep = step
+		}
+	}
+	for i := 0; i < l.n && i < len(c.X); i += xStep {
+		drawText(img, c.X[i], int(l.x(i)), plot.Max.Y+30, alignCenter)
+	}
+	base := l.y(l.yMin)
+	if c.Bar {
+		for i, v := range c.Y {
+			bar := image.Rect(int(l.x(i)-l.cell*0.4), int(l.y(v)), int(l.x(i)+l.cell*0.4), int(base))
+			draw.Draw(img, bar, image.NewUniform(lineColor), image.Point{}, draw.Src)
+		}
+	} else if l.n > 0 {
+		if c.Fill {
+			fillUnder(img, l, c.Y, base)
+		}
+		for i := 1; i < l.n; i++ {
+			drawLine(img, l.x(i-1), l.y(c.Y[i-1]), l.x(i), l.y(c.Y[i]))
+		}
+		if l.n == 1 {
+			drawLine(img, l.x(0), l.y(c.Y[0]), l.x(0), l.y(c.Y[0]))
+		}
+	}
+	drawText(img, c.Title, width/2, marginTop/2, alignCenter)
+	drawText(img, c.XLabel, marginLeft+plot.Dx()/2, height-30, alignCenter)
+	drawText(img, c.YLabel, 30, marginTop+plot.Dy()/2, alignVertical)
+	return img
+}
+
+//填充折线下方的区域
+func fillUnder(img *image.RGBA, l *layout, ys []float64, base float64) {
+	for i := 1; i < len(ys); i++ {
+		x0, x1 := l.x(i-1), l.x(i)
+		y0, y1 := l.y(ys[i-1]), l.y(ys[i])
+		for x := int(math.Ceil(x0)); x < int(math.Ceil(x1)); x++ {
+			t := (float64(x) - x0) / (x1 - x0)
+			top := int(y0 + (y1-y0)*t)
+			for y := top; y < int(base); y++ {
+				img.SetRGBA(x, y, blend(img.RGBAAt(x, y), fillColor, fillAlpha))
+			}
+		}
+	}
+}
+
+//按 alpha 的透明度将 src 叠加到 dst 上
+func blend(dst, src color.RGBA, alpha float64) color.RGBA {
+	mix := func(d, s uint8) uint8 {
+		return uint8(float64(d)*(1-alpha) + float64(s)*alpha)
+	}
+	return color.RGBA{R: mix(dst.R, src.R), G: mix(dst.G, src.G), B: mix(dst.B, src.B), A: 0xff}
+}
+
+//绘制宽度为3像素的线段
+func drawLine(img *image.RGBA, x0, y0, x1, y1 float64) {
+	steps := int(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))) + 1
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		x := int(x0 + (x1-x0)*t)
+		y := int(y0 + (y1-y0)*t)
+		draw.Draw(img, image.Rect(x-1, y-1, x+2, y+2), image.NewUniform(lineColor), image.Point{}, draw.Src)
+	}
+}
+
+type align int
+
+const (
+	alignCenter   align = iota
+	alignRight          //右对齐
+	alignVertical       //逆时针旋转90度后居中，用于y轴名称
+)
+
+//位图中文字使用的字体，优先使用简体中文字形
+var textFace = bitmapfont.FaceSC
+
+//绘制文字，(x, y) 为文字的对齐点，y 为文字的垂直中心
+func drawText(img *image.RGBA, s string, x, y int, a align) {
+	metrics := textFace.Metrics()
+	w := font.MeasureString(textFace, s).Ceil()
+	h := metrics.Height.Ceil()
+	if w == 0 {
+		return
+	}
+	//先绘制原始大小的文字，再放大 textScale 倍
+	src := image.NewAlpha(image.Rect(0, 0, w, h))
+	d := &font.Drawer{
+		Dst:  src,
+		Src:  image.Opaque,
+		Face: textFace,
+		Dot:  fixed.P(0, metrics.Ascent.Ceil()),
+	}
+	d.DrawString(s)
+	left := x - w*textScale/2
+	if a == alignRight {
+		left = x - w*textScale
+	}
+	top := y - h*textScale/2
+	if a == alignVertical {
+		left, top = x-h*textScale/2, y-w*textScale/2
+	}
+	for sy := 0; sy < h; sy++ {
+		for sx := 0; sx < w; sx++ {
+			if src.AlphaAt(sx, sy).A == 0 {
+				continue
+			}
+			dx, dy := sx, sy
+			if a == alignVertical {
+				dx, dy = sy, w-1-sx
+			}
+			r := image.Rect(left+dx*textScale, top+dy*textScale, left+(dx+1)*textScale, top+(dy+1)*textScale)
+			draw.Draw(img, r, image.NewUniform(textColor), image.Point{}, draw.Src)
+		}
+	}
+}
+
+// Draw 绘制数据总结中的四张图表，保存在 dir 目录中，返回图片的文件路径，
+//顺序为：总评论数，粉丝数，平均延迟，延迟中位数
+func Draw(s *Summary, dir string, format Format) ([]string, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	r := Aggregate(s)
+	timeRange := fmt.Sprintf("%s - %s", unixFormat(s.Start, "01-02"), unixFormat(s.End, "01-02"))
+	charts := []struct {
+		name  string
+		chart Chart
+	}{
+		{"hot", Chart{
+			Title:  timeRange + " 十分钟内总评论数",
+			XLabel: "时间", YLabel: "评论数", X: r.Times, Y: r.Hot, Bar: true,
+		}},
+		{"fans", Chart{
+			Title:  timeRange + " 粉丝数变化",
+			XLabel: "时间", YLabel: "粉丝数", X: r.Times, Y: r.Fans,
+		}},
+		{"delay_mean", Chart{
+			Title:  timeRange + " 十分钟内平均延迟（单位：秒）",
+			XLabel: "时间", YLabel: "平均延迟", X: r.Times, Y: r.DelayMean, Fill: true,
+		}},
+		{"delay_median", Chart{
+			Title:  timeRange + " 十分钟内延迟中位数（单位：秒）",
+			XLabel: "时间", YLabel: "延迟中位数", X: r.Times, Y: r.DelayMedian, Fill: true,
+		}},
+	}
+	files := make([]string, 0, len(charts))
+	for _, item := range charts {
+		fileName := fmt.Sprintf("%s/%s.%s", dir, item.name, format)
+		if err := item.chart.Save(fileName, format); err != nil {
+			return files, err
+		}
+		files = append(files, fileName)
+	}
+	return files, nil
+}
@@ -0,0 +1,24 @@
+package analyse
+
+import (
+	"testing"
+)
+
+//位图字体中需要包含图表中用到的所有文字
+func TestTextFace(t *testing.T) {
+	s := &Summary{Start: 1660000000, End: 1660086400}
+	dir := t.TempDir()
+	if _, err := Draw(s, dir, PNG); err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{
+		"十分钟内总评论数", "粉丝数变化", "十分钟内平均延迟（单位：秒）", "十分钟内延迟中位数（单位：秒）",
+		"时间", "评论数", "粉丝数", "平均延迟", "延迟中位数", "0123456789-: .",
+	} {
+		for _, r := range text {
+			if _, ok := textFace.GlyphAdvance(r); !ok {
+				t.Errorf("missing glyph: %q in %s", r, text)
+			}
+		}
+	}
+}
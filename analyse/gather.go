@@ -0,0 +1,113 @@
+package analyse
+
+import (
+	"sort"
+	"time"
+)
+
+// Step 数据聚合的步长，一个数据代表一分钟内的数据，所以10个聚合则是10分钟内的数据
+const Step = 10
+
+// Result 聚合后的数据
+type Result struct {
+	Times       []string  //每个聚合区间的开始时间，格式为 15:04
+	Hot         []float64 //十分钟内的总评论数
+	DelayMean   []float64 //十分钟内延迟的平均值
+	DelayMedian []float64 //十分钟内延迟的中位数
+	Fans        []float64 //粉丝数变化，本身就是每十分钟记录一次，不需要聚合
+}
+
+// Gather 数据聚合，每 step 个数据使用 f 聚合为一个，舍弃末尾不足 step 个的数据
+func Gather(data []float64, step int, f func([]float64) float64) []float64 {
+	row := len(data) / step
+	r := make([]float64, 0, row)
+	for i := 0; i < row; i++ {
+		r = append(r, f(data[i*step:(i+1)*step]))
+	}
+	return r
+}
+
+// Sum 求和
+func Sum(data []float64) float64 {
+	var sum float64
+	for _, v := range data {
+		sum += v
+	}
+	return sum
+}
+
+// Mean 平均值
+func Mean(data []float64) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	return Sum(data) / float64(len(data))
+}
+
+// Median 中位数
+func Median(data []float64) float64 {
+	l := len(data)
+	if l == 0 {
+		return 0
+	}
+	sorted := make([]float64, l)
+	copy(sorted, data)
+	sort.Float64s(sorted)
+	if l%2 == 1 {
+		return sorted[l/2]
+	}
+	return (sorted[l/2-1] + sorted[l/2]) / 2
+}
+
+//将 data 的长度填充为 step 的倍数，填充的值为 value
+func pad(data []float64, step int, value float64) []float64 {
+	for len(data)%step != 0 {
+		data = append(data, value)
+	}
+	return data
+}
+
+func toFloat(data []int) []float64 {
+	r := make([]float64, len(data))
+	for i, v := range data {
+		r[i] = float64(v)
+	}
+	return r
+}
+
+// Aggregate 将每分钟的数据按十分钟聚合
+func Aggregate(s *Summary) *Result {
+	//统计时段内的每一分钟
+	var times []int64
+	for t := s.Start; t < s.End+60; t += 60 {
+		times = append(times, t)
+	}
+	for len(times)%Step != 0 {
+		last := s.Start
+		if len(times) > 0 {
+			last = times[len(times)-1] + 60
+		}
+		times = append(times, last)
+	}
+	hot := pad(toFloat(s.Board.Hot), Step, 0)
+	delay := toFloat(s.Board.Awl)
+	//延迟使用最后一个值填充
+	var lastDelay float64
+	if len(delay) > 0 {
+		lastDelay = delay[len(delay)-1]
+	}
+	delay = pad(delay, Step, lastDelay)
+
+	r := &Result{
+		Hot: Gather(hot, Step, Sum),
+		// 延迟数据会受某些极端值影响，这里同时计算平均值和中位数
+		// 这部分极端值产生的原因可能和发布评论的账号有关，而不是和评论区有关
+		DelayMean:   Gather(delay, Step, Mean),
+		DelayMedian: Gather(delay, Step, Median),
+		Fans:        toFloat(s.Account.FansCount),
+	}
+	for i := 0; i < len(times); i += Step {
+		r.Times = append(r.Times, time.Unix(times[i], 0).Format("15:04"))
+	}
+	return r
+}
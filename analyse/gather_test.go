@@ -0,0 +1,69 @@
+package analyse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGather(t *testing.T) {
+	data := []float64{1, 2, 3, 4, 5, 6, 7}
+	tests := []struct {
+		name string
+		f    func([]float64) float64
+		want []float64
+	}{
+		{"sum", Sum, []float64{6, 15}},
+		{"mean", Mean, []float64{2, 5}},
+		{"median", Median, []float64{2, 5}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Gather(data, 3, test.f); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got: %v, except: %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		name string
+		data []float64
+		want float64
+	}{
+		{"empty", nil, 0},
+		{"odd", []float64{3, 1, 2}, 2},
+		{"even", []float64{4, 1, 3, 2}, 2.5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Median(test.data); got != test.want {
+				t.Errorf("got: %v, except: %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	s := &Summary{Start: 0, End: 12 * 60}
+	s.Board.Hot = []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 2, 2}
+	s.Board.Awl = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 20}
+	s.Account.FansCount = []int{100, 101}
+	r := Aggregate(s)
+	if len(r.Times) != 2 {
+		t.Fatalf("times: %v", r.Times)
+	}
+	if want := []float64{10, 4}; !reflect.DeepEqual(r.Hot, want) {
+		t.Errorf("hot got: %v, except: %v", r.Hot, want)
+	}
+	//不足十分钟的延迟使用最后一个值填充
+	if want := []float64{5.5, 20}; !reflect.DeepEqual(r.DelayMean, want) {
+		t.Errorf("delay mean got: %v, except: %v", r.DelayMean, want)
+	}
+	if want := []float64{5.5, 20}; !reflect.DeepEqual(r.DelayMedian, want) {
+		t.Errorf("delay median got: %v, except: %v", r.DelayMedian, want)
+	}
+	if want := []float64{100, 101}; !reflect.DeepEqual(r.Fans, want) {
+		t.Errorf("fans got: %v, except: %v", r.Fans, want)
+	}
+}
@@ -144,8 +144,8 @@ def draw_plot(x, y, x_label, y_label, title, save_path, is_bar: bool = False, is
     plt.clf()
 
 
-# 处理数据并绘图
-def draw(data: dict):
+# 处理数据并绘图，图片保存在 img_dir 中
+def draw(data: dict, img_dir: str):
     fans = np.array(data['account']['fansCount'])
     board = data['board']
     start = data['start']
@@ -180,7 +180,6 @@ def draw(data: dict):
     # 取十分钟内的中位数
     delay_median = gather(delay, step, np.median)
 
-    img_dir = "./report/img"
     if not os.path.exists(img_dir):
         os.makedirs(img_dir)
     time_range = "%s - %s" % (time.strftime("%m-%d", time.localtime(start)),
@@ -202,7 +201,9 @@ def main():
     file_name = sys.argv[1]
     with open(file_name, encoding='utf-8') as f:
         data = json.load(f)
-    draw(data)
+    # 每个数据文件的图片单独保存，避免同时汇总多个评论区时相互覆盖
+    img_dir = "./report/img/" + os.path.splitext(os.path.basename(file_name))[0]
+    draw(data, img_dir)
     board = data['board']
     account = data['account']
     start_all_count = board['startAllCount']
@@ -255,22 +256,22 @@ def main():
         return
     # 发布动态
     images = []
-    hot_img = upload_img("./report/img/hot.jpg")
+    hot_img = upload_img(img_dir + "/hot.jpg")
     if hot_img is None:
         logger.log("上传图片：hot失败")
         return
     images.append(hot_img)
-    fans_img = upload_img("./report/img/fans.jpg")
+    fans_img = upload_img(img_dir + "/fans.jpg")
     if fans_img is None:
         logger.log("上传图片：fans失败")
         return
     images.append(fans_img)
-    delay_mean_img = upload_img("./report/img/delay_mean.jpg")
+    delay_mean_img = upload_img(img_dir + "/delay_mean.jpg")
     if delay_mean_img is None:
         logger.log("上传图片，delay_mean失败")
         return
     images.append(delay_mean_img)
-    delay_median_img = upload_img("./report/img/delay_median.jpg")
+    delay_median_img = upload_img(img_dir + "/delay_median.jpg")
     if delay_median_img is None:
         logger.log("上传图片：delay_median失败")
         return
@@ -297,15 +298,19 @@ if __name__ == '__main__':
     logger.log("使用字体：%s", font_name)
     selected_font = fm.FontProperties(fname=font_list[font_name])
 
-    headers = {
-        'user-agent': 'Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) '
-                      'Chrome/96.0.4664.93 Safari/537.36',
-        'sec-ch-ua': 'ot A;Brand";v="99", "Chromium";v="96", "Google Chrome";v="96',
-        'sec-ch-ua-mobile': '?0',
-        'sec-ch-ua-platform': 'Windows',
-        'accept-language': 'zh-CN,zh;q=0.9',
-        "Accept-Encoding": "gzip, deflate, br"
-    }
+    # 请求头由 bobo-bot 通过环境变量传入，与 bot 的其它请求保持一致
+    headers = json.loads(os.environ.get('BOBO_HEADERS', '{}'))
+    if not headers:
+        headers = {
+            'User-Agent': 'Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) '
+                          'Chrome/131.0.0.0 Safari/537.36',
+            'Accept': 'application/json, text/plain, */*',
+            'Accept-Language': 'zh-CN,zh;q=0.9',
+            'Accept-Encoding': 'gzip, deflate, br',
+            'sec-ch-ua': '"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"',
+            'sec-ch-ua-mobile': '?0',
+            'sec-ch-ua-platform': '"Windows"',
+        }
     cookie = dict()
     with open("./setting.json", encoding='utf-8') as setting:
         setting_json = json.load(setting)
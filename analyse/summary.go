@@ -0,0 +1,94 @@
+// Package analyse
+//处理数据总结，绘制图表并生成总结文本，不依赖外部的运行环境
+package analyse
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+type Summary struct {
+	Version string `json:"version"` //对应程序的版本号
+	Start   int64  `json:"start"`   //统计的开始时间
+	End     int64  `json:"end"`     //统计结束时间
+	Board   struct {
+		Name          string         `json:"name"`          //版聊区名称
+		DynamicId     uint64         `json:"dynamicId"`     //对应的动态id
+		BvID          string         `json:"bvID"`          //如果是视频评论区，则是对应视频的bv号，否则为空
+		Oid           uint64         `json:"oid"`           //oid
+		Hot           []int          `json:"hot"`           //每分钟内的评论数
+		Awl           []int          `json:"awl"`           //每分钟内的最大延迟
+		Pages         []int          `json:"pages"`         //每分钟内获取评论时最多翻的页数
+		People        map[uint64]int `json:"people"`        //参与评论的用户，键为uid, 值为发送的评论数
+		Count         int            `json:"count"`         //记录到的评论数，不含楼中楼
+		StartAllCount int            `json:"startAllCount"` //开始时的总评论数，包含楼中楼
+		StartCount    int            `json:"startCount"`    //开始时的评论数，不含楼中楼
+		EndAllCount   int            `json:"endAllCount"`   //结束时的总评论数，包含楼中楼
+		EndCount      int            `json:"endCount"`      //结束时的评论数，不含楼中楼
+		SubHot        []int          `json:"subHot"`        //每分钟内的楼中楼评论数
+		SubPeople     map[uint64]int `json:"subPeople"`     //发送楼中楼评论的用户，键为uid, 值为发送的评论数
+		SubCount      int            `json:"subCount"`      //记录到的楼中楼评论数
+	} `json:"board"`
+	Account struct {
+		Name           string `json:"name"`           //用户名
+		Alias          string `json:"alias"`          //别名
+		Uid            uint64 `json:"uid"`            //uid
+		StartFollowers int    `json:"startFollowers"` //粉丝数
+		EndFollowers   int    `json:"endFollowers"`
+		FansCount      []int  `json:"fansCount"` //粉丝数变化
+	} `json:"account"`
+}
+
+// Load 读取数据总结文件
+func Load(fileName string) (*Summary, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var summary Summary
+	err = json.NewDecoder(f).Decode(&summary)
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// Message 生成数据总结的文本，用于发布动态
+func (s *Summary) Message() string {
+	board := &s.Board
+	account := &s.Account
+	//每分钟评论数最多的时间点
+	maxHot, maxHotTime := 0, 0
+	for i, hot := range board.Hot {
+		if hot > maxHot {
+			maxHot = hot
+			maxHotTime = i
+		}
+	}
+	//单个账号最多发送的评论数
+	maxNum := 0
+	for _, num := range board.People {
+		if num > maxNum {
+			maxNum = num
+		}
+	}
+	start := time.Unix(s.Start, 0)
+	end := time.Unix(s.End, 0)
+	hotTime := time.Unix(s.Start+int64(maxHotTime)*60, 0)
+	return fmt.Sprintf("【数据总结】%s-%s\n"+
+		"【%s】粉丝数变化：%d => %d(%+d)\n"+
+		"【%s】评论数变化：%d => %d(%+d)\n"+
+		"不含楼中楼评论数：%d => %d(%+d)\n"+
+		"%s 达到最高同接：%d条/分钟\n"+
+		"发送评论人数：%d\n"+
+		"单个账号最多发送评论：%d 条",
+		start.Format("01月02日"), end.Format("01月02日"),
+		account.Name, account.StartFollowers, account.EndFollowers, account.EndFollowers-account.StartFollowers,
+		board.Name, board.StartAllCount, board.EndAllCount, board.EndAllCount-board.StartAllCount,
+		board.StartCount, board.EndCount, board.EndCount-board.StartCount,
+		hotTime.Format("01-02 15:04"), maxHot,
+		len(board.People), maxNum)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Hami-Lemon/bobo-bot/request"
+)
+
+// APIError b站接口返回的错误，code 不为0或者响应状态码大于等于400
+type APIError struct {
+	Code     int64  //响应中的 code，响应状态码错误时为0
+	Message  string //响应中的 message
+	Endpoint string //请求地址的路径
+	Status   int    //响应状态码
+}
+
+//常见的错误，使用 errors.Is 判断，只比较 code
+var (
+	ErrNotLogin       = &APIError{Code: -101, Message: "账号未登录"}
+	ErrCsrf           = &APIError{Code: -111, Message: "csrf 校验失败"}
+	ErrRateLimit      = &APIError{Code: -412, Message: "请求被拦截"}
+	ErrCommentDeleted = &APIError{Code: 12022, Message: "评论已被删除"}
+	ErrAlreadyLiked   = &APIError{Code: 65006, Message: "已赞过"}
+)
+
+func (e *APIError) Error() string {
+	if e.Code == 0 {
+		return fmt.Sprintf("status=%d, endpoint=%s", e.Status, e.Endpoint)
+	}
+	return fmt.Sprintf("code=%d, msg=%s, endpoint=%s", e.Code, e.Message, e.Endpoint)
+}
+
+// Is code 相同时认为是同一种错误，响应状态码为412时同样认为是 ErrRateLimit
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	if !ok {
+		return false
+	}
+	if t.Code == ErrRateLimit.Code && e.Status == http.StatusPreconditionFailed {
+		return true
+	}
+	return e.Code != 0 && e.Code == t.Code
+}
+
+//将请求时的错误转换为 APIError，网络错误等其它错误原样返回
+func statusError(err error) error {
+	var s *request.StatusError
+	if errors.As(err, &s) {
+		return &APIError{Endpoint: s.Path, Status: s.Status}
+	}
+	return err
+}
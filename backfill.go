@@ -0,0 +1,104 @@
+package main
+
+import (
+	"time"
+)
+
+//补充获取程序停止期间发布的评论，以数据库中该评论区最新的评论为准往前翻页，
+//从检查点恢复时以检查点中最近一次获取到的评论为准，检查点之后保存到数据库中的评论也需要计数，
+//返回获取到的评论，数据库中没有该评论区的评论时返回 nil
+func (b *Bot) backfill() []Comment {
+	lastRpid, lastCtime, ok := db.NewestComment(b.board.oid)
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	seen := func(rpid uint64) bool {
+		return rpid <= lastRpid || b.last.Contains(rpid)
+	}
+	if b.last.Len() > 0 {
+		counted := b.lastCounted()
+		seen = func(rpid uint64) bool {
+			return rpid <= counted || b.last.Contains(rpid)
+		}
+	}
+	comments, pages, err := b.bili.GetComments(b.board, seen, b.backfillPage)
+	if err != nil {
+		b.logger.Error("补充获取评论失败，oid=%d, %v", b.board.oid, err)
+	}
+	if err != nil && len(comments) == 0 {
+		return nil
+	}
+	count := 0
+	overlap := false
+	for _, comment := range comments {
+		if seen(comment.replyId) {
+			overlap = true
+			continue
+		}
+		b.missed(comment, now, comment.replyId <= lastRpid)
+		count++
+	}
+	if !overlap && pages >= b.backfillPage {
+		b.logger.Warn("补充获取评论的翻页数达到上限：%d，可能遗漏了部分评论", pages)
+	}
+	b.logger.Info("补充获取程序停止期间的评论：%d 条，页数：%d，上一条评论：rpid=%d, ctime=%s",
+		count, pages, lastRpid, time.Unix(int64(lastCtime), 0).Format("01-02 15:04:05"))
+	return comments
+}
+
+//从检查点恢复后，以检查点中最近一次获取到的评论为准往前翻页，处理程序停止期间发布的评论，
+//用于没有补充获取或者数据库中没有该评论区的评论时，返回获取到的评论，获取失败时返回 nil
+func (b *Bot) settle() []Comment {
+	now := time.Now()
+	lastRpid, _, _ := db.NewestComment(b.board.oid)
+	counted := b.lastCounted()
+	seen := func(rpid uint64) bool {
+		return rpid <= counted || b.last.Contains(rpid)
+	}
+	comments, pages, err := b.bili.GetComments(b.board, seen, b.maxPage)
+	if err != nil {
+		b.logger.Error("获取程序停止期间的评论失败，oid=%d, %v", b.board.oid, err)
+	}
+	if err != nil && len(comments) == 0 {
+		return nil
+	}
+	count := 0
+	for _, comment := range comments {
+		if seen(comment.replyId) {
+			continue
+		}
+		b.missed(comment, now, comment.replyId <= lastRpid)
+		count++
+	}
+	b.logger.Info("处理程序停止期间的评论：%d 条，页数：%d", count, pages)
+	return comments
+}
+
+//检查点中最近一次获取到的评论中最新的 rpid，之前的评论都已经计数
+func (b *Bot) lastCounted() uint64 {
+	var counted uint64
+	for _, rpid := range b.last.Slice() {
+		if rpid > counted {
+			counted = rpid
+		}
+	}
+	return counted
+}
+
+//处理程序停止期间发布的评论并计数，设置了 backfillLike 时按规则点赞，不回复和推送，
+//stored 表示评论在程序停止前已经保存到数据库中（保存检查点之后），这时只计数，不覆盖已有的点赞状态
+func (b *Bot) missed(comment Comment, now time.Time, stored bool) {
+	if !stored {
+		comment.backfill = true
+		db.InsertComment(comment, now.Unix())
+		like := b.backfillLike && b.rules.Like(comment, now)
+		if like && b.Liking() {
+			b.like(comment)
+		} else {
+			b.skipLike(comment, like, now)
+		}
+	}
+	//这部分评论的延迟没有意义，不计入延迟统计
+	b.counter.CountMissed(comment)
+}
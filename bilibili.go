@@ -8,8 +8,15 @@ import (
 	"github.com/Hami-Lemon/bobo-bot/request"
 	"github.com/Hami-Lemon/bobo-bot/util"
 	"github.com/tidwall/gjson"
+	"io"
 	"math"
+	"mime"
+	"os"
+	"path/filepath"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 //用于身份授权的 cookie 的键名
@@ -21,6 +28,24 @@ const (
 	SId           = "sid"
 )
 
+//登录 cookie 的域名，发送给 bilibili.com 及其所有子域名
+const cookieDomain = "bilibili.com"
+
+//点赞评论的请求路径，点赞的频率限制需要单独设置
+const likePath = "/x/v2/reply/action"
+
+//内置的请求频率限制，键为请求路径，空字符串为没有单独设置的路径共用的限制，设置中的 limit 可以覆盖
+var defaultLimits = map[string]request.Limit{
+	"":                                     {Rate: 5, Burst: 10},
+	"/x/v2/reply/main":                     {Rate: 2, Burst: 5},   //获取评论
+	"/x/v2/reply/reply":                    {Rate: 2, Burst: 5},   //获取楼中楼
+	"/x/v2/reply/add":                      {Rate: 0.2, Burst: 1}, //回复评论
+	"/x/polymer/web-dynamic/v1/feed/space": {Rate: 0.5, Burst: 2}, //获取动态列表
+	"/x/polymer/web-dynamic/v1/detail":     {Rate: 0.5, Burst: 2}, //获取动态详情
+	"/x/space/wbi/acc/info":                {Rate: 0.2, Burst: 2}, //获取个人资料
+	"/x/relation/stat":                     {Rate: 0.5, Burst: 2}, //获取粉丝数
+}
+
 // Account 普通用户
 type Account struct {
 	uname string //该账号的昵称
@@ -31,9 +56,11 @@ type Account struct {
 // MonitorAccount 赛博监控账号
 type MonitorAccount struct {
 	Account
-	follower int    //粉丝数
-	face     string //头像
-	sign     string //签名
+	follower  int    //粉丝数
+	face      string //头像
+	sign      string //签名
+	live      bool   //是否正在直播
+	liveTitle string //直播间标题
 }
 
 // BotAccount bot所登录的账号
@@ -43,6 +70,8 @@ type BotAccount struct {
 	sessData string //cookies中的SESSDATA
 	csrf     string //cookies中的bili_jct，部分接口请求参数中的csrf也是该值
 	sid      string //cookies中的sid
+	//刷新 cookie 时使用的 refresh_token，扫码登录时获取
+	refreshToken string
 }
 
 // Comment 一条评论
@@ -53,6 +82,12 @@ type Comment struct {
 	replyId  uint64 //评论id
 	typeCode int    //评论区类型码
 	oid      uint64 //评论区的id
+	root     uint64 //楼中楼评论所在楼的rpid，不是楼中楼则为0
+	parent   uint64 //楼中楼评论回复的评论的rpid，不是楼中楼则为0
+	rcount   int    //该评论的回复数
+	like     int    //该评论的点赞数
+	backfill bool   //是否为程序启动时补充获取的评论
+	deleted  bool   //评论是否已被删除，从评论区中获取到的评论都没有被删除
 }
 
 // Board 评论区，或者叫版聊区
@@ -66,25 +101,59 @@ type Board struct {
 	bvID     string //视频的bv号，针对视频的评论区
 }
 
+// Dynamic 账号发布的动态
+type Dynamic struct {
+	id      string    //动态id
+	kind    string    //动态类型，例如：DYNAMIC_TYPE_WORD
+	text    string    //动态的文字内容
+	pubTime time.Time //发布时间
+	top     bool      //是否为置顶动态
+}
+
+// Picture 上传到b站的图片
+type Picture struct {
+	url    string  //图片地址
+	width  int     //宽度
+	height int     //高度
+	size   float64 //图片大小，单位：KB
+}
+
 // BiliBili 与b站后台接口交互的对象
 type BiliBili struct {
-	user   BotAccount
-	client *request.Client
-	logger *logger.Logger //日志
+	user     BotAccount
+	userLock sync.RWMutex //登录账号可能在运行时更新
+	client   *request.Client
+	logger   *logger.Logger //日志
+	login    int32          //登录状态是否有效，1为有效
+	expired  chan struct{}  //登录状态失效时发送信号
 }
 
+//检查响应，code 不为0时返回 *APIError
 func checkResp(entity request.Entity, err error) (*gjson.Result, error) {
 	if util.IsError(err, "request fail!") {
+		return nil, statusError(err)
+	}
+	var body []byte
+	if buf, ok := entity.Reader().(*bytes.Buffer); ok {
+		body = buf.Bytes()
+	} else if body, err = io.ReadAll(entity.Reader()); err != nil {
 		return nil, err
 	}
-	reader := entity.Reader().(*bytes.Buffer)
 	//使用 gjson 库获取响应体中的数据
-	result := gjson.ParseBytes(reader.Bytes())
+	result := gjson.ParseBytes(body)
 	//code 不为0，出现错误
 	code := result.Get("code").Int()
 	if code != 0 {
-		msg := result.Get("message").String()
-		return nil, errors.New(fmt.Sprintf("code=%d, msg=%s", code, msg))
+		apiErr := &APIError{
+			Code:    code,
+			Message: result.Get("message").String(),
+		}
+		if e, ok := entity.(*request.ByteEntity); ok {
+			apiErr.Endpoint = e.Path()
+			apiErr.Status = e.Status()
+		}
+		apiErrors.Inc(apiErr.Endpoint, strconv.FormatInt(code, 10))
+		return nil, apiErr
 	}
 	data := result.Get("data")
 	//没有 data 字段
@@ -94,65 +163,109 @@ func checkResp(entity request.Entity, err error) (*gjson.Result, error) {
 	return &data, nil
 }
 
-func BiliBiliLogin(user BotAccount) *BiliBili {
-	header := map[string]string{
-		"User-Agent":         "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/96.0.4664.93 Safari/537.36",
-		"Accept-Language":    "zh-CN,zh;q=0.9",
-		"Accept-Encoding":    "gzip, deflate, br",
-		"sec-ch-ua":          `ot A;Brand";v="99", "Chromium";v="96", "Google Chrome";v="96`,
-		"sec-ch-ua-mobile":   "?0",
-		"sec-ch-ua-platform": "Windows",
-	}
+//请求b站接口时使用的请求头，由设置中的 config.profile 决定，所有请求共用同一份
+var browserHeader, _ = request.ProfileHeader(request.DefaultProfile)
 
-	cookie := map[string]string{
-		DedeUserID:    strconv.FormatUint(user.uid, 10),
-		DedeUserIDMd5: user.uidMd5,
-		SessData:      user.sessData,
-		Csrf:          user.csrf,
-		SId:           user.sid,
+// BiliBiliLogin 使用 user 中的 cookie 登录，cookie 无效时返回 ErrNotLogin，
+//jar 为之前保存的 cookie，可以为 nil，其中与登录相关的 cookie 会被 user 中的覆盖
+func BiliBiliLogin(user BotAccount, jar *request.Jar) (*BiliBili, error) {
+	if jar == nil {
+		jar = request.NewJar()
+	}
+	client := request.NewWithJar(browserHeader, jar, 3)
+	client.SetObserver(observeRequest)
+	b := &BiliBili{
+		client:  client,
+		logger:  logger.New("BiliBili", logLevel, logDst),
+		expired: make(chan struct{}, 1),
 	}
-	biliLogger := logger.New("BiliBili", logLevel, logDst)
-	client := request.New(header, cookie, 3)
-	//获取用户名，判断该 cookie 是否有效
+	b.SetAccount(user)
+	if err := b.CheckSession(); err != nil {
+		return nil, err
+	}
+	b.logger.Debug("登录成功! uname: %s", b.User().uname)
+	return b, nil
+}
+
+// CheckSession 检查 cookie 是否有效，有效时更新用户名并恢复登录状态，cookie 无效时返回 ErrNotLogin
+func (b *BiliBili) CheckSession() error {
 	urlStr := "https://api.bilibili.com/x/member/web/account"
-	data, err := checkResp(client.Get(urlStr, nil, nil))
+	data, err := checkResp(b.client.Get(urlStr, nil, nil))
 	if err != nil {
-		biliLogger.Error("登录失败：%v", err)
-		return nil
+		b.check(err)
+		return err
 	}
+	b.userLock.Lock()
 	//用户名
-	user.uname = data.Get("uname").String()
-	user.alias = "bot"
-	biliLogger.Debug("登录成功! uname: %s", user.uname)
-	return &BiliBili{
-		user:   user,
-		client: client,
-		logger: biliLogger,
+	b.user.uname = data.Get("uname").String()
+	b.user.alias = "bot"
+	b.userLock.Unlock()
+	atomic.StoreInt32(&b.login, 1)
+	return nil
+}
+
+// SetAccount 更新登录账号的 cookie，需要调用 CheckSession 检查新的 cookie 是否有效
+func (b *BiliBili) SetAccount(user BotAccount) {
+	b.userLock.Lock()
+	defer b.userLock.Unlock()
+	b.user = user
+	b.client.SetCookie(cookieDomain, DedeUserID, strconv.FormatUint(user.uid, 10))
+	b.client.SetCookie(cookieDomain, DedeUserIDMd5, user.uidMd5)
+	b.client.SetCookie(cookieDomain, SessData, user.sessData)
+	b.client.SetCookie(cookieDomain, Csrf, user.csrf)
+	b.client.SetCookie(cookieDomain, SId, user.sid)
+}
+
+// User 当前登录的账号
+func (b *BiliBili) User() BotAccount {
+	b.userLock.RLock()
+	defer b.userLock.RUnlock()
+	return b.user
+}
+
+// LoggedIn 登录状态是否有效
+func (b *BiliBili) LoggedIn() bool {
+	return atomic.LoadInt32(&b.login) == 1
+}
+
+// Expired 登录状态失效时可以从返回的 chan 中接收到信号
+func (b *BiliBili) Expired() <-chan struct{} {
+	return b.expired
+}
+
+//检查接口返回的错误，未登录时将登录状态标记为失效，只在第一次失效时发送信号
+func (b *BiliBili) check(err error) error {
+	if errors.Is(err, ErrNotLogin) && atomic.CompareAndSwapInt32(&b.login, 1, 0) {
+		b.logger.Error("登录状态失效：%v", err)
+		select {
+		case b.expired <- struct{}{}:
+		default:
+		}
 	}
+	return err
 }
 
-// LikeComment 点赞评论
-func (b *BiliBili) LikeComment(comment Comment) bool {
-	urlStr := "https://api.bilibili.com/x/v2/reply/action"
+// LikeComment 点赞评论，评论已经被删除时返回 ErrCommentDeleted，已经点过赞时返回 ErrAlreadyLiked
+func (b *BiliBili) LikeComment(comment Comment) error {
+	user := b.User()
+	urlStr := "https://api.bilibili.com" + likePath
 	body := request.NewNameValeEntity(
 		map[string]interface{}{
 			"type":     comment.typeCode,
 			"oid":      comment.oid,
 			"rpid":     comment.replyId,
 			"action":   1,
-			"csrf":     b.user.csrf,
+			"csrf":     user.csrf,
 			"ordering": "time",
 		}, request.ApplicationUrlencoded)
 
 	_, err := checkResp(b.client.Post(urlStr, nil, body))
 	if err != nil {
-		b.logger.Error("点赞评论失败：%v", err)
-		pushAndLog(b.logger, "点赞评论失败：%v", err)
-		return false
+		return b.check(err)
 	}
 	b.logger.Debug("成功点赞：%s uname: %s uid: %d",
 		comment.msg, comment.uname, comment.uid)
-	return true
+	return nil
 }
 
 // HateComment 点踩
@@ -168,7 +281,7 @@ func (b *BiliBili) ReportComment() {
 }
 
 // GetCommentsPage 获取评论区的评论数
-func (b *BiliBili) GetCommentsPage(board *Board) bool {
+func (b *BiliBili) GetCommentsPage(board *Board) error {
 	urlStr := "https://api.bilibili.com/x/v2/reply/main"
 	params := map[string]interface{}{
 		"oid":  board.oid,
@@ -178,19 +291,20 @@ func (b *BiliBili) GetCommentsPage(board *Board) bool {
 	}
 	data, err := checkResp(b.client.GetWithRetry(urlStr, params, nil, 2))
 	if err != nil {
-		b.logger.Error("获取评论数量失败：oid: %d, %v", board.oid, err)
-		pushAndLog(b.logger, "获取评论数量失败：oid: %d, %v", board.oid, err)
-		return false
+		return err
 	}
 	cursor := data.Get("cursor")
 	board.allCount = int(cursor.Get("all_count").Int())
 	board.count = int(cursor.Get("prev").Int())
 	b.logger.Debug("获取评论数成功，all_count:%d, count:%d", board.allCount, board.count)
-	return true
+	return nil
 }
 
-// GetComments 获取评论
-func (b *BiliBili) GetComments(board Board) []Comment {
+// GetComments 获取评论，按时间从新到旧排序，每页30条，
+//从最新的一页开始往前翻页，直到某一页中出现 seen 返回 true 的评论，或者已经没有更多评论，或者翻页数达到 maxPage，
+//seen 为 nil 时只根据 maxPage 判断，返回获取到的评论以及实际请求的页数，
+//某一页获取失败时返回之前已经获取到的评论和错误，第一页就失败时评论为空，但不为 nil，需要根据错误判断是否获取成功
+func (b *BiliBili) GetComments(board Board, seen func(rpid uint64) bool, maxPage int) ([]Comment, int, error) {
 	urlStr := "https://api.bilibili.com/x/v2/reply/main"
 	params := map[string]interface{}{
 		"oid":  board.oid,
@@ -199,45 +313,112 @@ func (b *BiliBili) GetComments(board Board) []Comment {
 		"mode": 2, //按时间排序
 	}
 
-	data, err := checkResp(b.client.Get(urlStr, params, nil))
-	if err != nil {
-		b.logger.Error("获取评论失败：oid: %d, %v", board.oid, err)
-		pushAndLog(b.logger, "获取评论失败：oid: %d, %v", board.oid, err)
-		return nil
-	}
-	//获取评论，默认获取20条
-	replies := data.Get("replies").Array()
-	repliesLen := len(replies)
-	comments := make([]Comment, repliesLen)
-	for i := repliesLen - 1; i >= 0; i-- {
-		reply := replies[i]
-		comment := Comment{
-			Account: Account{
-				uid:   reply.Get("mid").Uint(),
-				uname: reply.Get("member.uname").String(),
-			},
-			ctime:    reply.Get("ctime").Uint(),
-			msg:      reply.Get("content.message").String(),
-			replyId:  reply.Get("rpid").Uint(),
-			typeCode: board.typeCode,
-			oid:      board.oid,
+	comments := make([]Comment, 0, 30)
+	page := 0
+	for page < maxPage {
+		data, err := checkResp(b.client.Get(urlStr, params, nil))
+		if err != nil {
+			//已经获取到的评论仍然有效
+			return comments, page, fmt.Errorf("page %d: %w", page+1, err)
+		}
+		page++
+		replies := data.Get("replies").Array()
+		found := false
+		for _, reply := range replies {
+			comment := Comment{
+				Account: Account{
+					uid:   reply.Get("mid").Uint(),
+					uname: reply.Get("member.uname").String(),
+				},
+				ctime:    reply.Get("ctime").Uint(),
+				msg:      reply.Get("content.message").String(),
+				replyId:  reply.Get("rpid").Uint(),
+				typeCode: board.typeCode,
+				oid:      board.oid,
+				rcount:   int(reply.Get("rcount").Int()),
+				like:     int(reply.Get("like").Int()),
+			}
+			if seen != nil && seen(comment.replyId) {
+				found = true
+			}
+			comments = append(comments, comment)
+			b.logger.Debug("获取到评论：%#v", comment)
+		}
+		cursor := data.Get("cursor")
+		if found || len(replies) == 0 || cursor.Get("is_end").Bool() {
+			break
+		}
+		params["next"] = cursor.Get("next").Int()
+	}
+	b.logger.Debug("获取评论成功：oid: %d, 获取评论数：%d, 页数：%d", board.oid, len(comments), page)
+	return comments, page, nil
+}
+
+// GetSubComments 获取楼中楼评论，root 为楼中楼所在的楼，每页20条，
+//楼中楼按时间从旧到新排序，所以从最后一页开始往前翻页，直到遇到 rpid 不大于 last 的评论，
+//last 为0时表示不知道已经获取过哪些评论，此时只获取最新的 need 条，最多翻 maxPage 页，返回的评论按时间从新到旧排序，
+//某一页获取失败时返回之前已经获取到的评论和错误
+func (b *BiliBili) GetSubComments(board Board, root Comment, last uint64, need, maxPage int) ([]Comment, error) {
+	urlStr := "https://api.bilibili.com/x/v2/reply/reply"
+	const ps = 20
+	params := map[string]interface{}{
+		"oid":  board.oid,
+		"type": board.typeCode,
+		"root": root.replyId,
+		"ps":   ps,
+	}
+	var comments []Comment
+	pn := (root.rcount + ps - 1) / ps
+	for page := 0; pn > 0 && page < maxPage; page++ {
+		params["pn"] = pn
+		data, err := checkResp(b.client.Get(urlStr, params, nil))
+		if err != nil {
+			return comments, fmt.Errorf("pn %d: %w", pn, err)
 		}
-		comments[i] = comment
-		b.logger.Debug("获取到评论：%#v", comment)
+		replies := data.Get("replies").Array()
+		done := false
+		for i := len(replies) - 1; i >= 0; i-- {
+			reply := replies[i]
+			comment := Comment{
+				Account: Account{
+					uid:   reply.Get("mid").Uint(),
+					uname: reply.Get("member.uname").String(),
+				},
+				ctime:    reply.Get("ctime").Uint(),
+				msg:      reply.Get("content.message").String(),
+				replyId:  reply.Get("rpid").Uint(),
+				typeCode: board.typeCode,
+				oid:      board.oid,
+				root:     reply.Get("root").Uint(),
+				parent:   reply.Get("parent").Uint(),
+				like:     int(reply.Get("like").Int()),
+			}
+			if (last != 0 && comment.replyId <= last) || (last == 0 && len(comments) >= need) {
+				done = true
+				break
+			}
+			comments = append(comments, comment)
+			b.logger.Debug("获取到楼中楼评论：%#v", comment)
+		}
+		if done || len(replies) == 0 {
+			break
+		}
+		pn--
 	}
-	b.logger.Debug("获取评论成功：oid: %d, 获取评论数：%d", board.oid, len(comments))
-	return comments
+	b.logger.Debug("获取楼中楼评论成功：oid: %d, root: %d, 获取评论数：%d", board.oid, root.replyId, len(comments))
+	return comments, nil
 }
 
 // PostComment 发评论，board 为对应的评论区，comment 不为空则表示评论区中回复对应的评论
-func (b *BiliBili) PostComment(board Board, comment *Comment, msg string) bool {
+func (b *BiliBili) PostComment(board Board, comment *Comment, msg string) error {
+	user := b.User()
 	urlStr := "https://api.bilibili.com/x/v2/reply/add"
 	body := request.NewNameValeEntity(map[string]interface{}{
 		"type":    board.typeCode,
 		"oid":     board.oid,
 		"message": msg,
 		"plat":    1,
-		"csrf":    b.user.csrf,
+		"csrf":    user.csrf,
 	}, request.ApplicationUrlencoded)
 	if comment != nil {
 		body.Add("root", comment.replyId)
@@ -246,12 +427,108 @@ func (b *BiliBili) PostComment(board Board, comment *Comment, msg string) bool {
 	}
 	_, err := checkResp(b.client.Post(urlStr, nil, body))
 	if err != nil {
-		b.logger.Error("发布评论失败：oid: %d, msg: %s, err: %v",
-			board.oid, msg, err)
-		return false
+		return b.check(err)
 	}
 	b.logger.Debug("发布评论成功：oid: %d, msg: %s", board.oid, msg)
-	return true
+	return nil
+}
+
+// UploadImage 上传图片，用于发布带图片的动态，fileName 为图片的文件路径
+func (b *BiliBili) UploadImage(fileName string) (*Picture, error) {
+	user := b.User()
+	urlStr := "https://api.bilibili.com/x/dynamic/feed/draw/upload_bfs"
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(fileName))
+	if contentType == "" {
+		contentType = "image/jpeg"
+	}
+	body := request.NewMultipartEntity()
+	err = body.AddFile("file_up", filepath.Base(fileName), contentType, f)
+	if err == nil {
+		err = body.AddField("biz", "new_dyn")
+	}
+	if err == nil {
+		err = body.AddField("category", "daily")
+	}
+	if err == nil {
+		err = body.AddField("csrf", user.csrf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := checkResp(b.client.Post(urlStr, nil, body))
+	if err != nil {
+		return nil, b.check(err)
+	}
+	pic := &Picture{
+		url:    data.Get("image_url").String(),
+		width:  int(data.Get("image_width").Int()),
+		height: int(data.Get("image_height").Int()),
+		size:   float64(stat.Size()) / 1024,
+	}
+	b.logger.Debug("上传图片成功：%s, url: %s", fileName, pic.url)
+	return pic, nil
+}
+
+// PostDynamic 发布动态，pics 为动态中的图片，可以为空，返回动态的id
+func (b *BiliBili) PostDynamic(text string, pics []Picture) (string, error) {
+	user := b.User()
+	urlStr := "https://api.bilibili.com/x/dynamic/feed/create/dyn"
+	now := time.Now()
+	dynReq := map[string]interface{}{
+		"content": map[string]interface{}{
+			"contents": []map[string]interface{}{
+				{
+					"raw_text": text,
+					"type":     1,
+					"biz_id":   "",
+				},
+			},
+		},
+		"meta": map[string]interface{}{
+			"app_meta": map[string]interface{}{
+				"from":     "create.dynamic.web",
+				"mobi_app": "web",
+			},
+		},
+		"scene":       1, //有图片为2，无图为1
+		"attach_card": nil,
+		"upload_id":   fmt.Sprintf("%d_%d_%d", user.uid, now.Unix(), now.Nanosecond()/100000),
+	}
+	if len(pics) > 0 {
+		items := make([]map[string]interface{}, 0, len(pics))
+		for _, pic := range pics {
+			items = append(items, map[string]interface{}{
+				"img_src":    pic.url,
+				"img_width":  pic.width,
+				"img_height": pic.height,
+				"img_size":   pic.size,
+			})
+		}
+		dynReq["pics"] = items
+		dynReq["scene"] = 2
+	}
+	body := request.NewNameValeEntity(map[string]interface{}{
+		"dyn_req": dynReq,
+	}, request.ApplicationJson)
+	params := map[string]interface{}{
+		"csrf": user.csrf,
+	}
+	data, err := checkResp(b.client.Post(urlStr, params, body))
+	if err != nil {
+		return "", b.check(err)
+	}
+	dynId := data.Get("dyn_id_str").String()
+	b.logger.Debug("发布动态成功：https://t.bilibili.com/%s", dynId)
+	return dynId, nil
 }
 
 //bv号转av号，参考自：https://github.com/SocialSisterYi/bilibili-API-collect/blob/master/other/bvid_desc.md
@@ -275,7 +552,7 @@ func bv2av(bv string) int64 {
 	return (av - add) ^ xor
 }
 
-func (b *BiliBili) dynamicCommentDetail(board *Board) bool {
+func (b *BiliBili) dynamicCommentDetail(board *Board) error {
 	urlStr := "https://api.bilibili.com/x/polymer/web-dynamic/v1/detail"
 	params := map[string]interface{}{
 		"timezone_offset": 0,
@@ -283,54 +560,84 @@ func (b *BiliBili) dynamicCommentDetail(board *Board) bool {
 	}
 	data, err := checkResp(b.client.Get(urlStr, params, nil))
 	if err != nil {
-		b.logger.Error("获取评论区信息失败，oid: %d, err: %v", board.oid, err)
-		pushAndLog(b.logger, "获取评论区信息失败，oid: %d, err: %v", board.oid, err)
-		return false
+		return err
 	}
 	board.oid, _ = strconv.ParseUint(data.Get("item.basic.comment_id_str").String(),
 		10, 64)
 	board.typeCode = int(data.Get("item.basic.comment_type").Int())
 	//board.allCount = int(data.Get("modules.module_stat.comment.count").Int())
-	return true
+	return nil
 }
 
-func (b *BiliBili) videoCommentDetail(board *Board) bool {
+func (b *BiliBili) videoCommentDetail(board *Board) error {
 	bv := board.bvID
 	if len(bv) != 12 || (bv[0] != 'B' || bv[1] != 'V') {
-		return false
+		return fmt.Errorf("bv号格式错误：%s", bv)
 	}
 	board.oid = uint64(bv2av(bv))
 	board.typeCode = 1
-	return true
+	return nil
 }
 
 // BoardDetail 获取评论区详细信息
-func (b *BiliBili) BoardDetail(board *Board) bool {
-	var ok bool
+func (b *BiliBili) BoardDetail(board *Board) error {
+	var err error
 	if board.dId != 0 {
-		ok = b.dynamicCommentDetail(board)
+		err = b.dynamicCommentDetail(board)
 	} else if board.bvID != "" {
-		ok = b.videoCommentDetail(board)
+		err = b.videoCommentDetail(board)
 	} else {
-		b.logger.Error("未指定评论区")
-		return false
+		return errors.New("未指定评论区")
 	}
-	if !ok {
-		return false
+	if err != nil {
+		return err
 	}
 	if board.name == "" {
 		board.name = "未命名版"
 	}
 	b.logger.Debug("评论区信息：type: %d, oid: %d", board.typeCode, board.oid)
-	return true
+	return nil
 }
 
-func (b *BiliBili) AccountSpace(account MonitorAccount) {
-	//https://api.bilibili.com/x/polymer/web-dynamic/v1/feed/space?offset=&host_mid=33605910&timezone_offset=-480
+// AccountSpace 获取账号发布的动态，从新到旧排列，offset 为上一页返回的偏移量，第一页为空字符串，
+//返回下一页的偏移量，没有下一页时为空字符串
+func (b *BiliBili) AccountSpace(account MonitorAccount, offset string) ([]Dynamic, string, error) {
+	urlStr := "https://api.bilibili.com/x/polymer/web-dynamic/v1/feed/space"
+	params := map[string]interface{}{
+		"host_mid":        account.uid,
+		"offset":          offset,
+		"timezone_offset": -480,
+		"features":        "itemOpusStyle",
+	}
+	data, err := checkResp(b.client.GetWbi(urlStr, params, nil))
+	if err != nil {
+		return nil, "", err
+	}
+	items := data.Get("items").Array()
+	dynamics := make([]Dynamic, 0, len(items))
+	for _, item := range items {
+		modules := item.Get("modules")
+		text := modules.Get("module_dynamic.desc.text").String()
+		if text == "" {
+			//图文动态的内容
+			text = modules.Get("module_dynamic.major.opus.summary.text").String()
+		}
+		dynamics = append(dynamics, Dynamic{
+			id:      item.Get("id_str").String(),
+			kind:    item.Get("type").String(),
+			text:    text,
+			pubTime: time.Unix(modules.Get("module_author.pub_ts").Int(), 0),
+			top:     modules.Get("module_tag.text").String() == "置顶",
+		})
+	}
+	if !data.Get("has_more").Bool() {
+		return dynamics, "", nil
+	}
+	return dynamics, data.Get("offset").String(), nil
 }
 
 // AccountStat 获取账号粉丝数
-func (b *BiliBili) AccountStat(account *MonitorAccount) bool {
+func (b *BiliBili) AccountStat(account *MonitorAccount) error {
 	//https://api.bilibili.com/x/relation/stat?vmid=33605910&jsonp=jsonp
 	urlStr := "https://api.bilibili.com/x/relation/stat"
 	params := map[string]interface{}{
@@ -338,24 +645,22 @@ func (b *BiliBili) AccountStat(account *MonitorAccount) bool {
 	}
 	data, err := checkResp(b.client.Get(urlStr, params, nil))
 	if err != nil {
-		b.logger.Error("获取粉丝数失败：uid：%d, err: %v", account.uid, err)
-		return false
+		return err
 	}
 	account.follower = int(data.Get("follower").Int())
 	b.logger.Debug("获取粉丝数：uid: %d, follower: %d", account.uid, account.follower)
-	return true
+	return nil
 }
 
 // AccountInfo 获取详细信息：用户昵称，头像，签名
-func (b *BiliBili) AccountInfo(account *MonitorAccount) bool {
-	urlStr := "https://api.bilibili.com/x/space/acc/info"
+func (b *BiliBili) AccountInfo(account *MonitorAccount) error {
+	urlStr := "https://api.bilibili.com/x/space/wbi/acc/info"
 	params := map[string]interface{}{
 		"mid": account.uid,
 	}
-	data, err := checkResp(b.client.Get(urlStr, params, nil))
+	data, err := checkResp(b.client.GetWbi(urlStr, params, nil))
 	if err != nil {
-		b.logger.Error("获取用户信息失败：uid: %d, err: %v", account.uid, err)
-		return false
+		return err
 	}
 	//用户名
 	account.uname = data.Get("name").String()
@@ -366,7 +671,10 @@ func (b *BiliBili) AccountInfo(account *MonitorAccount) bool {
 	account.face = data.Get("face").String()
 	//签名
 	account.sign = data.Get("sign").String()
+	//直播间
+	account.live = data.Get("live_room.liveStatus").Int() == 1
+	account.liveTitle = data.Get("live_room.title").String()
 	b.logger.Debug("获取用户信息：uid: %d, uname: %s, alias: %s, face: %s, sign: %s",
 		account.uid, account.uname, account.alias, account.face, account.sign)
-	return true
+	return nil
 }
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
 	"testing"
+
+	"github.com/Hami-Lemon/bobo-bot/request"
 )
 
 func TestBv2av(t *testing.T) {
@@ -21,3 +24,34 @@ func TestBv2av(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckResp(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error
+	}{
+		{"ok", `{"code":0,"data":{}}`, nil},
+		{"not login", `{"code":-101,"message":"账号未登录"}`, ErrNotLogin},
+		{"deleted", `{"code":12022,"message":"已经被删除了"}`, ErrCommentDeleted},
+		{"liked", `{"code":65006,"message":"已赞过"}`, ErrAlreadyLiked},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entity := request.NewByteEntity([]byte(test.body), request.ApplicationJson)
+			_, err := checkResp(entity, nil)
+			if !errors.Is(err, test.want) && err != test.want {
+				t.Errorf("got: %v, except: %v", err, test.want)
+			}
+			if test.want != nil && errors.Is(err, ErrCsrf) {
+				t.Errorf("%v should not be %v", err, ErrCsrf)
+			}
+		})
+	}
+	//响应状态码为412
+	_, err := checkResp(nil, &request.StatusError{Status: 412, Path: "/x/v2/reply/main"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrRateLimit) {
+		t.Errorf("got: %v, except: %v", err, ErrRateLimit)
+	}
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Hami-Lemon/bobo-bot/analyse"
 	"github.com/Hami-Lemon/bobo-bot/logger"
 	"github.com/Hami-Lemon/bobo-bot/set"
 	"github.com/Hami-Lemon/bobo-bot/util"
@@ -18,31 +23,54 @@ const (
 	CountCap = 24 * 60
 )
 
+//重新点赞失败的评论
+const (
+	likeRetryInterval = 5 * time.Minute  //检查是否有需要重新点赞的评论的间隔
+	likeRetryCooldown = 10 * time.Minute //点赞失败后至少间隔多久才重试
+	likeRetryAge      = 24 * time.Hour   //只重试这段时间内获取到的评论
+	likeRetryMax      = 3                //最多重试的次数
+)
+
+var (
+	errLikeQueueFull = errors.New("点赞任务队列已满")
+	errLikeNotLogin  = errors.New("登录状态失效")
+)
+
 type Counter struct {
 	todayComment int            //统计时段内记录到的评论数
 	peopleCount  map[uint64]int //参与评论的用户，记录不同用户的发评数量
 
 	hotCount  []int //统计时间段中，每一分钟内的评论数，数组索引表示距离统计开始时间的偏移量，单位分钟
 	awlCount  []int //每一分钟内的延迟统计
+	pageCount []int //每一分钟内获取评论时最多翻的页数
 	fansCount []int //粉丝数变化
 
+	subComment     int            //统计时段内记录到的楼中楼评论数
+	subPeopleCount map[uint64]int //发送楼中楼评论的用户，记录不同用户的发评数量
+	subHotCount    []int          //每一分钟内的楼中楼评论数
+
 	startTime time.Time  //统计的开始时间点
 	lock      sync.Mutex //互斥锁
 }
 
-// Reporter 延迟反馈报告
-type Reporter struct {
-	offset   int    //误差
-	last     uint64 //上一次反馈时间
-	interval int    // 两次反馈的间隔时间
+//楼中楼评论的获取状态
+type subState struct {
+	rcount int    //上次获取时该楼的回复数
+	last   uint64 //已经获取到的最新楼中楼评论的 rpid，为0表示未知
 }
 
 // BotOption Bot的可配置项
 type BotOption struct {
-	freshCD int     //获取评论cd
-	likeCD  float32 //点赞cd，单位：秒
-	isLike  bool    //是否开启点赞
-	isPost  bool    //是否发布数据总结动态
+	freshCD      int            //获取评论cd
+	isLike       bool           //是否开启点赞
+	isPost       bool           //是否发布数据总结动态
+	maxPage      int            //每次获取评论时最多翻的页数
+	checkpoint   int            //每隔多少分钟保存一次检查点，为0则不保存
+	backfillPage int            //启动时补充获取评论最多翻的页数，为0则不补充获取
+	backfillLike bool           //是否点赞补充获取到的评论
+	python       bool           //是否使用 python 脚本处理数据总结
+	format       analyse.Format //数据总结图片的格式
+	rules        []Rule         //评论的处理规则
 }
 
 type Bot struct {
@@ -54,34 +82,55 @@ type Bot struct {
 	stop      chan struct{} //退出信号
 	likeQueue chan Comment  //点赞评论的任务队列
 	BotOption
-	report *Reporter
+	rules    *RuleSet             //评论的处理规则
+	last     *set.HashSet[uint64] //最近一次获取到的评论
+	lastLock sync.Mutex           //只有监控协程会修改 last，其他协程读取 last 时需要加锁
+
+	likeOn int32 //是否点赞，运行时可以修改，初始值为 isLike，使用原子操作读写
+	postOn int32 //是否发布数据总结动态，运行时可以修改，初始值为 isPost
+
+	fetch     FetchStatus //最近一次获取评论的情况
+	fetchLock sync.Mutex
+}
+
+// FetchStatus 获取评论的情况
+type FetchStatus struct {
+	Time     int64 `json:"time"`     //获取评论的时间
+	Latency  int64 `json:"latency"`  //获取评论的耗时，单位：毫秒
+	Pages    int   `json:"pages"`    //翻的页数
+	Comments int   `json:"comments"` //获取到的评论数
+	New      int   `json:"new"`      //新的评论数
 }
 
 func NewBot(bili *BiliBili, board Board,
 	monitor MonitorAccount, opt BotOption) *Bot {
-	if !bili.AccountInfo(&monitor) {
-		mainLogger.Error("获取用户信息失败！")
+	if err := bili.AccountInfo(&monitor); err != nil {
+		mainLogger.Error("获取用户信息失败！uid=%d, %v", monitor.uid, err)
 	}
-	if !bili.AccountStat(&monitor) {
-		mainLogger.Error("获取粉丝数失败！")
+	if err := bili.AccountStat(&monitor); err != nil {
+		mainLogger.Error("获取粉丝数失败！uid=%d, %v", monitor.uid, err)
 	}
-	if !bili.BoardDetail(&board) {
-		mainLogger.Error("获取评论区信息失败！")
+	if err := bili.BoardDetail(&board); err != nil {
+		mainLogger.Error("获取评论区信息失败！name=%s, %v", board.name, err)
+		pushAndLog(mainLogger, "获取评论区信息失败！name=%s, %v", board.name, err)
 	}
-	if !bili.GetCommentsPage(&board) {
-		mainLogger.Error("获取评论数量失败！")
+	if err := bili.GetCommentsPage(&board); err != nil {
+		mainLogger.Error("获取评论数量失败！oid=%d, %v", board.oid, err)
 	}
 	now := time.Now()
 	counter := Counter{
-		peopleCount: make(map[uint64]int),
-		hotCount:    make([]int, 0, CountCap),
-		awlCount:    make([]int, 0, CountCap),
-		fansCount:   make([]int, 1),
-		startTime:   now,
+		peopleCount:    make(map[uint64]int),
+		hotCount:       make([]int, 0, CountCap),
+		awlCount:       make([]int, 0, CountCap),
+		pageCount:      make([]int, 0, CountCap),
+		fansCount:      make([]int, 1),
+		subPeopleCount: make(map[uint64]int),
+		subHotCount:    make([]int, 0, CountCap),
+		startTime:      now,
 	}
 	counter.fansCount[0] = monitor.follower
 
-	return &Bot{
+	bot := &Bot{
 		board:     board,
 		monitor:   monitor,
 		bili:      bili,
@@ -90,15 +139,40 @@ func NewBot(bili *BiliBili, board Board,
 		stop:      make(chan struct{}, 1),
 		likeQueue: make(chan Comment, 32),
 		BotOption: opt,
-		report: &Reporter{
-			offset:   opt.freshCD,
-			interval: 60 * 3, //三分钟内只触发一次
-		},
+		rules:     newRuleSet(opt.rules, board.name, monitor.Account, opt.freshCD),
+		last:      set.New[uint64](),
 	}
+	bot.SetLike(opt.isLike)
+	bot.SetPost(opt.isPost)
+	return bot
+}
+
+//根据数据总结中的数据创建统计器
+func newCounter(summary *analyse.Summary) *Counter {
+	counter := &Counter{
+		todayComment:   summary.Board.Count,
+		peopleCount:    summary.Board.People,
+		hotCount:       summary.Board.Hot,
+		awlCount:       summary.Board.Awl,
+		pageCount:      summary.Board.Pages,
+		fansCount:      summary.Account.FansCount,
+		subComment:     summary.Board.SubCount,
+		subPeopleCount: summary.Board.SubPeople,
+		subHotCount:    summary.Board.SubHot,
+		startTime:      time.Unix(summary.Start, 0),
+	}
+	//旧版本的数据中没有楼中楼的统计
+	if counter.peopleCount == nil {
+		counter.peopleCount = make(map[uint64]int)
+	}
+	if counter.subPeopleCount == nil {
+		counter.subPeopleCount = make(map[uint64]int)
+	}
+	return counter
 }
 
 // RecoverBot 使用上一次中断程序后保存的数据恢复
-func RecoverBot(bili *BiliBili, opt BotOption, summary Summary) *Bot {
+func RecoverBot(bili *BiliBili, opt BotOption, summary *analyse.Summary) *Bot {
 	if strings.Compare(summary.Version, Version) != 0 {
 		mainLogger.Warn("当前版本：%s，恢复信息版本：%s", Version, summary.Version)
 	}
@@ -107,8 +181,9 @@ func RecoverBot(bili *BiliBili, opt BotOption, summary Summary) *Bot {
 		dId:  summary.Board.DynamicId,
 		bvID: summary.Board.BvID,
 	}
-	if !bili.BoardDetail(&board) {
-		mainLogger.Error("获取评论区信息失败！")
+	if err := bili.BoardDetail(&board); err != nil {
+		mainLogger.Error("获取评论区信息失败！name=%s, %v", board.name, err)
+		pushAndLog(mainLogger, "获取评论区信息失败！name=%s, %v", board.name, err)
 	}
 	board.allCount = summary.Board.StartAllCount
 	board.count = summary.Board.StartCount
@@ -122,14 +197,7 @@ func RecoverBot(bili *BiliBili, opt BotOption, summary Summary) *Bot {
 		follower: summary.Account.StartFollowers,
 	}
 
-	counter := &Counter{
-		todayComment: summary.Board.Count,
-		peopleCount:  summary.Board.People,
-		hotCount:     summary.Board.Hot,
-		awlCount:     summary.Board.Awl,
-		fansCount:    summary.Account.FansCount,
-		startTime:    time.Unix(summary.Start, 0),
-	}
+	counter := newCounter(summary)
 	bot := &Bot{
 		board:     board,
 		monitor:   monitor,
@@ -139,11 +207,11 @@ func RecoverBot(bili *BiliBili, opt BotOption, summary Summary) *Bot {
 		stop:      make(chan struct{}, 1),
 		likeQueue: make(chan Comment, 32),
 		BotOption: opt,
-		report: &Reporter{
-			offset:   opt.freshCD,
-			interval: 60 * 3,
-		},
+		rules:     newRuleSet(opt.rules, board.name, monitor.Account, opt.freshCD),
+		last:      set.New[uint64](),
 	}
+	bot.SetLike(opt.isLike)
+	bot.SetPost(opt.isPost)
 	return bot
 }
 
@@ -153,27 +221,85 @@ func setAddComments(s *set.HashSet[uint64], c []Comment) {
 	}
 }
 
+//将最近一次获取到的评论替换为 c
+func (b *Bot) setLast(c []Comment) {
+	b.lastLock.Lock()
+	defer b.lastLock.Unlock()
+	b.last.Clear()
+	setAddComments(b.last, c)
+}
+
 // Monitor 开启赛博监控
 func (b *Bot) Monitor() {
-	if b.isLike {
-		go b.likeComment()
-	}
+	//运行时可能会开启点赞，所以总是处理点赞任务
+	go b.likeComment()
+	//只有监控协程会向点赞任务队列发送评论，由监控协程在结束时关闭
+	defer close(b.likeQueue)
 	tick := time.Tick(time.Duration(b.freshCD) * time.Second)
-	//获取评论
-	comments := b.bili.GetComments(b.board)
+	var checkpointTick <-chan time.Time
+	if b.checkpoint > 0 {
+		ticker := time.NewTicker(time.Duration(b.checkpoint) * time.Minute)
+		defer ticker.Stop()
+		checkpointTick = ticker.C
+	}
+	var comments []Comment
+	if b.backfillPage > 0 {
+		//补充获取程序停止期间的评论
+		comments = b.backfill()
+	}
+	if comments == nil && b.last.Len() > 0 {
+		//从检查点恢复，没有补充获取时也要处理程序停止期间的评论
+		comments = b.settle()
+	}
 	if comments == nil {
-		b.logger.Error("获取评论失败，oid=%d", b.board.oid)
-		return
+		//获取评论
+		var err error
+		comments, _, err = b.bili.GetComments(b.board, nil, 1)
+		if err != nil {
+			b.logger.Error("获取评论失败，oid=%d, %v", b.board.oid, err)
+			pushAndLog(b.logger, "获取评论失败，oid=%d, %v", b.board.oid, err)
+			return
+		}
 	}
-	lastComments := set.New[uint64]()
-	setAddComments(lastComments, comments)
+	if comments != nil {
+		b.setLast(comments)
+	}
+	//楼中楼的获取状态，键为楼的rpid，只记录最近一次获取到的楼
+	subStates := b.workSub(comments, nil, nil, time.Now())
+	//监控结束时关闭 done，停止重新点赞的协程
+	retried := make(chan []Comment)
+	done := make(chan struct{})
+	defer close(done)
+	go b.retryLikes(retried, done)
+	failing := false //上一次获取评论是否失败
 loop:
 	for {
 		select {
 		case <-b.stop:
 			break loop
+		case <-checkpointTick:
+			b.counter.lock.Lock()
+			b.saveCheckpoint()
+			b.counter.lock.Unlock()
+		case comments := <-retried:
+			for _, comment := range comments {
+				b.logger.Info("重新点赞评论，rpid=%d, msg=%s, uname=%s", comment.replyId, comment.msg, comment.uname)
+				b.like(comment)
+			}
 		case now := <-tick:
-			comments = b.bili.GetComments(b.board)
+			var pages int
+			var err error
+			comments, pages, err = b.bili.GetComments(b.board, func(rpid uint64) bool {
+				return b.last.Contains(rpid)
+			}, b.maxPage)
+			fetch := FetchStatus{
+				Time:     now.Unix(),
+				Latency:  time.Since(now).Milliseconds(),
+				Pages:    pages,
+				Comments: len(comments),
+			}
+			overlap := false //是否翻到了上次获取过的评论
+			var maxDelay float64
 			for _, comment := range comments {
 				select {
 				case <-b.stop:
@@ -182,73 +308,165 @@ loop:
 					break
 				}
 				//该评论出现在上次获取到的评论中，可能已经点赞了
-				if lastComments.Contains(comment.replyId) {
+				if b.last.Contains(comment.replyId) {
+					overlap = true
 					continue
 				}
 				b.work(comment, now)
 				b.counter.Count(comment, now)
-				//TODO 监控个人资料修改 #3
+				fetch.New++
+				if delay := float64(now.Unix() - int64(comment.ctime)); delay > maxDelay {
+					maxDelay = delay
+				}
 			}
-			if comments == nil {
-				b.logger.Error("获取评论失败，oid=%d, type=%d", b.board.oid, b.board.typeCode)
-			} else {
-				lastComments.Clear()
-				setAddComments(lastComments, comments)
+			b.fetchLock.Lock()
+			b.fetch = fetch
+			b.fetchLock.Unlock()
+			fetchedComments.Add(float64(fetch.Comments), b.board.name)
+			newComments.Add(float64(fetch.New), b.board.name)
+			if fetch.New > 0 {
+				commentDelay.Set(maxDelay, b.board.name)
 			}
-			b.logger.Debug("刷新CD")
+			if err != nil {
+				b.logger.Error("获取评论失败，oid=%d, type=%d, %v", b.board.oid, b.board.typeCode, err)
+			}
+			//只在开始获取失败和恢复时推送，避免每次刷新都推送
+			failed := err != nil && (errors.Is(err, ErrNotLogin) || len(comments) == 0)
+			if failed && !failing {
+				pushAndLog(b.logger, "获取评论失败，oid=%d, %v", b.board.oid, err)
+			} else if !failed && failing {
+				pushAndLog(b.logger, "恢复获取评论，oid=%d", b.board.oid)
+			}
+			failing = failed
+			//获取失败并且没有获取到评论时保留上次的评论
+			if err == nil || len(comments) > 0 {
+				subStates = b.workSub(comments, subStates, b.last, now)
+				b.setLast(comments)
+				b.counter.CountPage(pages, now)
+				if !overlap && pages >= b.maxPage {
+					b.logger.Warn("翻页数达到上限：%d，可能遗漏了部分评论，可以调小刷新间隔", pages)
+				}
+			}
+			b.logger.Debug("刷新CD, 页数：%d", pages)
 		}
 	}
+	//等待获取到的评论写入数据库
+	db.Flush()
 	b.logger.Info("停止监控")
 }
 
-// MonitorFans 监控粉丝数变化，十分钟更新一次
-func (b *Bot) MonitorFans() {
+//根据每层楼回复数的变化获取新的楼中楼评论，保存到数据库中并计数，
+//states 为上一次的获取状态，seen 为上一次获取到的楼，seen 为 nil 时只记录状态而不获取，返回本次的获取状态
+func (b *Bot) workSub(comments []Comment, states map[uint64]subState,
+	seen *set.HashSet[uint64], now time.Time) map[uint64]subState {
+	next := make(map[uint64]subState, len(comments))
+	for _, comment := range comments {
+		state, ok := states[comment.replyId]
+		if !ok {
+			if seen == nil || seen.Contains(comment.replyId) {
+				//没有该楼的获取状态，以当前的回复数为准
+				next[comment.replyId] = subState{rcount: comment.rcount}
+				continue
+			}
+			//新的楼，所有的回复都是新的
+			state = subState{}
+		}
+		if comment.rcount > state.rcount {
+			subs, err := b.bili.GetSubComments(b.board, comment, state.last,
+				comment.rcount-state.rcount, b.maxPage)
+			if err != nil {
+				b.logger.Error("获取楼中楼评论失败：oid=%d, root=%d, %v", b.board.oid, comment.replyId, err)
+			}
+			for _, sub := range subs {
+				db.InsertComment(sub, now.Unix())
+				b.counter.CountSub(sub)
+				b.logger.Info("获取到楼中楼评论，msg=%s, uname=%s, uid=%d, root=%d",
+					sub.msg, sub.uname, sub.uid, sub.root)
+				if sub.replyId > state.last {
+					state.last = sub.replyId
+				}
+			}
+		}
+		state.rcount = comment.rcount
+		next[comment.replyId] = state
+	}
+	return next
+}
+
+// MonitorFans 监控粉丝数变化，十分钟更新一次，
+//所有 bot 监控的是同一个账号，获取到的粉丝数会同步到每个 bot 的统计器中
+func MonitorFans(bili *BiliBili, group *BotGroup, stop <-chan struct{}) {
 	ticker := time.NewTicker(10 * time.Minute)
 	defer ticker.Stop()
 
+	bots := group.All()
+	if len(bots) == 0 {
+		return
+	}
 	account := &MonitorAccount{
 		Account: Account{
-			uid: b.monitor.uid,
+			uid: bots[0].monitor.uid,
 		},
-		follower: b.monitor.follower,
+		follower: bots[0].monitor.follower,
 	}
+	uid := strconv.FormatUint(account.uid, 10)
+	followers.Set(float64(account.follower), uid)
 	fansChange := func(c *Counter, fans int) {
 		c.lock.Lock()
 		defer c.lock.Unlock()
 		c.fansCount = append(c.fansCount, fans)
 	}
-	counter := b.counter
-	//db.InsertFollower(account.uid, counter.startTime.Unix(), account.follower)
 	for {
 		select {
-		case <-b.stop:
+		case <-stop:
 			return
 		case now := <-ticker.C:
-			if b.bili.AccountStat(account) {
-				b.logger.Info("获取粉丝数，uid=%d, fans=%d", account.uid, account.follower)
+			if err := bili.AccountStat(account); err == nil {
+				mainLogger.Info("获取粉丝数，uid=%d, fans=%d", account.uid, account.follower)
 				db.InsertFollower(account.uid, now.Unix(), account.follower)
-				fansChange(counter, account.follower)
+				followers.Set(float64(account.follower), uid)
+				for _, bot := range group.All() {
+					fansChange(bot.counter, account.follower)
+				}
 			} else {
-				b.logger.Error("获取粉丝数失败，uid=%d", account.uid)
+				mainLogger.Error("获取粉丝数失败，uid=%d, %v", account.uid, err)
 			}
 		}
 	}
 }
 
-//处理点赞任务
+//处理点赞任务，点赞的频率由 request.Client 的令牌桶限制
 func (b *Bot) likeComment() {
 	for comment := range b.likeQueue {
-		if b.bili.LikeComment(comment) {
+		likeQueueLen.Set(float64(len(b.likeQueue)), b.board.name)
+		now := time.Now().Unix()
+		//登录状态失效时暂停点赞，由 Session 推送提醒，恢复后重试
+		if !b.bili.LoggedIn() {
+			db.UpdateLike(comment, likeDropped, errLikeNotLogin, now)
+			continue
+		}
+		err := b.bili.LikeComment(comment)
+		switch {
+		case err == nil, errors.Is(err, ErrAlreadyLiked):
+			likeResult.Inc(b.board.name, "ok")
+			db.UpdateLike(comment, likeLiked, nil, now)
 			b.logger.Info("成功点赞评论, msg=%s, uname=%s, uid=%d",
 				comment.msg, comment.uname, comment.uid)
-		} else {
-			b.logger.Error("点赞评论失败,oid=%d, rpid=%d, msg=%s",
+		case errors.Is(err, ErrCommentDeleted):
+			//评论已经被删除，不需要点赞
+			db.UpdateLike(comment, likeDeleted, err, now)
+			b.logger.Info("评论已被删除，不点赞,oid=%d, rpid=%d, msg=%s",
 				comment.oid, comment.replyId, comment.msg)
-			//可能因为请求频繁而点赞失败，增加一倍cd时间
-			time.Sleep(time.Duration(b.likeCD*1000) * time.Millisecond)
+		case errors.Is(err, ErrNotLogin):
+			db.UpdateLike(comment, likeDropped, errLikeNotLogin, now)
+			b.logger.Warn("登录状态失效，稍后重新点赞评论,oid=%d, rpid=%d", comment.oid, comment.replyId)
+		default:
+			likeResult.Inc(b.board.name, "fail")
+			db.UpdateLike(comment, likeFailed, err, now)
+			//失败原因已经记录到数据库中，稍后重试，不推送提醒
+			b.logger.Error("点赞评论失败,oid=%d, rpid=%d, msg=%s, %v",
+				comment.oid, comment.replyId, comment.msg, err)
 		}
-		b.logger.Debug("点赞CD")
-		time.Sleep(time.Duration(b.likeCD*1000) * time.Millisecond)
 	}
 }
 
@@ -257,78 +475,133 @@ func (b *Bot) work(comment Comment, now time.Time) {
 	//插入到数据库中
 	db.InsertComment(comment, now.Unix())
 	bili := b.bili
+	rules := b.rules.Match(comment, now)
+	like := false
+	for _, rule := range rules {
+		like = like || rule.like
+	}
 	//点赞该评论
-	if b.isLike {
-		select {
-		case b.likeQueue <- comment:
-			break
-		default:
-			b.logger.Warn("缓冲区已满，不点赞该评论：msg=%s, uname=%s, uid=%d",
-				comment.msg, comment.uname, comment.uid)
-		}
+	if like && b.Liking() {
+		b.like(comment)
 	} else {
+		b.skipLike(comment, like, now)
 		b.logger.Info("获取到评论，msg=%s, uname=%s, uid=%d",
 			comment.msg, comment.uname, comment.uid)
 	}
-	//如果评论包含 test 触发延迟反馈
-	if strings.Contains(comment.msg, "test") {
-		//计算延迟，当前时间 - 评论发布时间 - freshCD
-		//如果小于0，则延迟为0
-		delay := b.report.Report(comment, now)
-		if delay == "" {
-			b.logger.Info("间隔过短，不触发延迟反馈")
-		} else {
-			if bili.PostComment(b.board, &comment, delay) {
-				b.logger.Info("反馈延迟成功：%s, rpid=%d, msg=%s, ctime=%d",
-					delay, comment.replyId, comment.msg, comment.ctime)
+	for _, rule := range rules {
+		if rule.reply == nil && rule.push == nil {
+			continue
+		}
+		if !rule.ready(now) {
+			b.logger.Info("间隔过短，不触发规则：%s", rule.name)
+			continue
+		}
+		data := b.rules.data(comment, now)
+		if rule.reply != nil && bili.LoggedIn() {
+			msg := render(rule.reply, data)
+			if err := bili.PostComment(b.board, &comment, msg); err != nil {
+				b.logger.Error("回复评论失败：%s, rule=%s, rpid=%d, msg=%s, ctime=%d, %v",
+					msg, rule.name, comment.replyId, comment.msg, comment.ctime, err)
 			} else {
-				b.logger.Error("反馈延迟失败, delay=%s, rpid=%d, msg=%s, ctime=%d",
-					delay, comment.replyId, comment.msg, comment.ctime)
+				b.logger.Info("回复评论成功：%s, rule=%s, rpid=%d, msg=%s, ctime=%d",
+					msg, rule.name, comment.replyId, comment.msg, comment.ctime)
 			}
 		}
+		if rule.push != nil {
+			pushAndLog(b.logger, "%s", render(rule.push, data))
+		}
 	}
-	//嘿嘿嘿...33的评论...小小的...香香的...
-	if comment.uid == b.monitor.uid {
-		pushAndLog(b.logger, "[%s]\n%s的评论：%s",
-			time.Unix(int64(comment.ctime), 0).Format("01-02 15:04:05"),
-			b.monitor.alias, comment.msg)
+}
+
+// Liking 是否点赞评论，登录状态失效时不点赞
+func (b *Bot) Liking() bool {
+	return atomic.LoadInt32(&b.likeOn) == 1 && b.bili.LoggedIn()
+}
+
+// SetLike 开启或关闭点赞
+func (b *Bot) SetLike(on bool) {
+	var v int32
+	if on {
+		v = 1
 	}
+	atomic.StoreInt32(&b.likeOn, v)
 }
 
-// Stop 停止赛博监控
-func (b *Bot) Stop() {
-	b.logger.Debug("调用停止函数")
-	close(b.stop)
-	close(b.likeQueue)
+// Posting 是否发布数据总结动态，登录状态失效时不发布
+func (b *Bot) Posting() bool {
+	return atomic.LoadInt32(&b.postOn) == 1 && b.bili.LoggedIn()
 }
 
-// Report 通过获取到评论的时间，减去评论的发出时间，计算延迟，nowTime为获取到该评论的时间
-func (r *Reporter) Report(comment Comment, nowTime time.Time) string {
-	now := uint64(nowTime.Unix())
-	delay := int(now-comment.ctime) - r.offset
-	// 因为设定每隔几秒获取一次评论，所以会存在几秒的误差，
-	// 如果计算的延迟小于该间隔时间，则延迟为0
-	if delay < 0 {
-		delay = 0
+// SetPost 开启或关闭发布数据总结动态
+func (b *Bot) SetPost(on bool) {
+	var v int32
+	if on {
+		v = 1
 	}
-	if r.last == 0 || int(now-r.last) > r.interval {
-		r.last = now
-	} else {
-		//间隔过短，不触发延迟反馈
-		return ""
+	atomic.StoreInt32(&b.postOn, v)
+}
+
+// Fetch 获取最近一次获取评论的情况
+func (b *Bot) Fetch() FetchStatus {
+	b.fetchLock.Lock()
+	defer b.fetchLock.Unlock()
+	return b.fetch
+}
+
+//将评论加入点赞任务队列，队列已满时等待重试
+func (b *Bot) like(comment Comment) {
+	select {
+	case b.likeQueue <- comment:
+		db.UpdateLike(comment, likeQueued, nil, time.Now().Unix())
+		likeQueueLen.Set(float64(len(b.likeQueue)), b.board.name)
+	default:
+		db.UpdateLike(comment, likeDropped, errLikeQueueFull, time.Now().Unix())
+		b.logger.Warn("缓冲区已满，稍后重新点赞该评论：msg=%s, uname=%s, uid=%d",
+			comment.msg, comment.uname, comment.uid)
 	}
-	var delayMsg string
-	if delay <= 60 {
-		delayMsg = fmt.Sprintf("延迟为%2d秒", delay)
-	} else if delay <= 60*60 {
-		delayMsg = fmt.Sprintf("延迟为%d分%02d秒", delay/60, delay%60)
-	} else {
-		s := delay % 60
-		delay /= 60
-		m, h := delay%60, delay/60
-		delayMsg = fmt.Sprintf("延迟为%d时%02d分%02d秒", h, m, s)
+}
+
+//记录没有点赞的原因，like 为规则是否点赞该评论，登录状态失效导致没有点赞的评论稍后重试
+func (b *Bot) skipLike(comment Comment, like bool, now time.Time) {
+	if like && atomic.LoadInt32(&b.likeOn) == 1 {
+		db.UpdateLike(comment, likeDropped, errLikeNotLogin, now.Unix())
+		return
 	}
-	return delayMsg
+	db.UpdateLike(comment, likeSkipped, nil, now.Unix())
+}
+
+//定时查询之前点赞失败或者没有加入任务队列的评论并发送给 retried，由监控协程重新加入点赞任务队列，
+//查询数据库在单独的协程中进行，避免阻塞获取评论，done 关闭后退出
+func (b *Bot) retryLikes(retried chan<- []Comment, done <-chan struct{}) {
+	ticker := time.NewTicker(likeRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			free := cap(b.likeQueue) - len(b.likeQueue)
+			if !b.Liking() || free <= 0 {
+				continue
+			}
+			comments := db.RetryLikes(b.board.oid, now.Add(-likeRetryCooldown).Unix(),
+				now.Add(-likeRetryAge).Unix(), likeRetryMax, free)
+			if len(comments) == 0 {
+				continue
+			}
+			select {
+			case retried <- comments:
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// Stop 停止赛博监控
+func (b *Bot) Stop() {
+	b.logger.Debug("调用停止函数")
+	close(b.stop)
 }
 
 // Count 评论数据计数，nowTime为获取到该评论的时间
@@ -359,6 +632,56 @@ func (c *Counter) Count(comment Comment, nowTime time.Time) {
 	}
 }
 
+// CountMissed 程序停止期间发布的评论计数，这部分评论的延迟没有意义，不计入延迟统计，统计开始之前发布的评论不计数
+func (c *Counter) CountMissed(comment Comment) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	//统计开始之前发布的评论不属于这次统计
+	index := int(int64(comment.ctime) - c.startTime.Unix())
+	if index < 0 {
+		return
+	}
+	c.peopleCount[comment.uid]++
+	c.todayComment++
+
+	index /= 60
+	var hot int
+	c.hotCount, hot = util.SliceGet(c.hotCount, index)
+	c.hotCount = util.SliceSet(c.hotCount, index, hot+1)
+}
+
+// CountSub 楼中楼评论计数，和楼的评论分开统计
+func (c *Counter) CountSub(comment Comment) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.subPeopleCount[comment.uid]++
+	c.subComment++
+
+	index := int(int64(comment.ctime) - c.startTime.Unix())
+	if index >= 0 {
+		index /= 60
+		var hot int
+		c.subHotCount, hot = util.SliceGet(c.subHotCount, index)
+		c.subHotCount = util.SliceSet(c.subHotCount, index, hot+1)
+	}
+}
+
+// CountPage 记录获取评论时翻的页数，nowTime为获取评论的时间
+func (c *Counter) CountPage(pages int, nowTime time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	index := int(nowTime.Unix()-c.startTime.Unix()) / 60
+	var p int
+	c.pageCount, p = util.SliceGet(c.pageCount, index)
+	//只记录最大页数
+	if pages > p {
+		c.pageCount = util.SliceSet(c.pageCount, index, pages)
+	}
+}
+
 //重置
 func (c *Counter) reset() {
 	//重置
@@ -366,38 +689,14 @@ func (c *Counter) reset() {
 	c.peopleCount = make(map[uint64]int)
 	c.hotCount = make([]int, 0, CountCap)
 	c.awlCount = make([]int, 0, CountCap)
+	c.pageCount = make([]int, 0, CountCap)
 	c.fansCount = make([]int, 0)
+	c.subComment = 0
+	c.subPeopleCount = make(map[uint64]int)
+	c.subHotCount = make([]int, 0, CountCap)
 	c.startTime = time.Now()
 }
 
-type Summary struct {
-	Version string `json:"version"` //对应程序的版本号
-	Start   int64  `json:"start"`   //统计的开始时间
-	End     int64  `json:"end"`     //统计结束时间
-	Board   struct {
-		Name          string         `json:"name"`          //版聊区名称
-		DynamicId     uint64         `json:"dynamicId"`     //对应的动态id
-		BvID          string         `json:"bvID"`          //如果是视频评论区，则是对应视频的bv号，否则为空
-		Oid           uint64         `json:"oid"`           //oid
-		Hot           []int          `json:"hot"`           //每分钟内的评论数
-		Awl           []int          `json:"awl"`           //每分钟内的最大延迟
-		People        map[uint64]int `json:"people"`        //参与评论的用户，键为uid, 值为发送的评论数
-		Count         int            `json:"count"`         //记录到的评论数，不含楼中楼
-		StartAllCount int            `json:"startAllCount"` //开始时的总评论数，包含楼中楼
-		StartCount    int            `json:"startCount"`    //开始时的评论数，不含楼中楼
-		EndAllCount   int            `json:"endAllCount"`   //结束时的总评论数，包含楼中楼
-		EndCount      int            `json:"endCount"`      //结束时的评论数，不含楼中楼
-	} `json:"board"`
-	Account struct {
-		Name           string `json:"name"`           //用户名
-		Alias          string `json:"alias"`          //别名
-		Uid            uint64 `json:"uid"`            //uid
-		StartFollowers int    `json:"startFollowers"` //粉丝数
-		EndFollowers   int    `json:"endFollowers"`
-		FansCount      []int  `json:"fansCount"` //粉丝数变化
-	} `json:"account"`
-}
-
 // Summarize 总结评论数据
 func (b *Bot) Summarize() string {
 	counter := b.counter
@@ -414,40 +713,30 @@ func (b *Bot) Summarize() string {
 		},
 	}
 	//未统计到数据
-	if len(counter.hotCount) == 0 && len(counter.fansCount) == 1 {
+	if len(counter.hotCount) == 0 && len(counter.subHotCount) == 0 && len(counter.fansCount) == 1 {
 		b.logger.Warn("未统计到数据")
 		return ""
 	}
-	b.bili.GetCommentsPage(board)
-	b.bili.AccountInfo(account)
-	b.bili.AccountStat(account)
+	if err := b.bili.GetCommentsPage(board); err != nil {
+		b.logger.Error("获取评论数量失败：oid=%d, %v", board.oid, err)
+	}
+	if err := b.bili.AccountInfo(account); err != nil {
+		b.logger.Error("获取用户信息失败：uid=%d, %v", account.uid, err)
+	}
+	if err := b.bili.AccountStat(account); err != nil {
+		b.logger.Error("获取粉丝数失败：uid=%d, %v", account.uid, err)
+	}
 
-	report := Summary{Version: Version}
-	report.Board.Name = b.board.name
-	report.Board.DynamicId = b.board.dId
-	report.Board.BvID = b.board.bvID
-	report.Board.Oid = b.board.oid
-	report.Start = counter.startTime.Unix()
-	report.End = time.Now().Unix()
-	report.Board.Hot = counter.hotCount
-	report.Board.Awl = counter.awlCount
-	report.Board.People = counter.peopleCount
-	report.Board.Count = counter.todayComment
-	report.Board.StartAllCount = b.board.allCount
-	report.Board.StartCount = b.board.count
+	report := b.snapshot()
 	report.Board.EndAllCount = board.allCount
 	report.Board.EndCount = board.count
-
 	report.Account.Name = account.uname
-	report.Account.Uid = b.monitor.uid
-	report.Account.Alias = b.monitor.alias
-	report.Account.StartFollowers = b.monitor.follower
 	report.Account.EndFollowers = account.follower
-	report.Account.FansCount = counter.fansCount
 
 	reportJson, _ := json.Marshal(report)
 	now := time.Now()
-	fileName := fmt.Sprintf("./report/%s.json", now.Format("200601021504"))
+	db.SaveSummary(b.board.oid, now.Unix(), reportJson)
+	fileName := fmt.Sprintf("./report/%s-%s.json", b.board.name, now.Format("200601021504"))
 	jsonFile, err := os.Create(fileName)
 	if err != nil && os.IsNotExist(err) {
 		err = os.Mkdir("./report", os.ModePerm)
@@ -464,19 +753,110 @@ func (b *Bot) Summarize() string {
 	b.board.allCount = board.allCount
 	b.board.count = board.count
 	counter.reset()
+	//统计数据已经重置，更新检查点，避免恢复时重复统计
+	b.saveCheckpoint()
 	b.logger.Info("数据保存为：%s", fileName)
 	return fileName
 }
 
+//根据当前的统计数据生成数据总结，结束时的数据使用当前的值，调用时需要持有统计器的锁
+func (b *Bot) snapshot() analyse.Summary {
+	counter := b.counter
+	report := analyse.Summary{Version: Version}
+	report.Board.Name = b.board.name
+	report.Board.DynamicId = b.board.dId
+	report.Board.BvID = b.board.bvID
+	report.Board.Oid = b.board.oid
+	report.Start = counter.startTime.Unix()
+	report.End = time.Now().Unix()
+	report.Board.Hot = counter.hotCount
+	report.Board.Awl = counter.awlCount
+	report.Board.Pages = counter.pageCount
+	report.Board.People = counter.peopleCount
+	report.Board.Count = counter.todayComment
+	report.Board.StartAllCount = b.board.allCount
+	report.Board.StartCount = b.board.count
+	report.Board.EndAllCount = b.board.allCount
+	report.Board.EndCount = b.board.count
+	report.Board.SubHot = counter.subHotCount
+	report.Board.SubPeople = counter.subPeopleCount
+	report.Board.SubCount = counter.subComment
+
+	report.Account.Name = b.monitor.uname
+	report.Account.Uid = b.monitor.uid
+	report.Account.Alias = b.monitor.alias
+	report.Account.StartFollowers = b.monitor.follower
+	report.Account.EndFollowers = b.monitor.follower
+	report.Account.FansCount = counter.fansCount
+	return report
+}
+
+// ReportSummarize 处理数据总结，绘制图表并生成总结文本
 func (b *Bot) ReportSummarize(fileName string) {
-	//调用python脚本，处理数据并发布动态
+	if b.python {
+		b.reportByPython(fileName)
+		return
+	}
+	summary, err := analyse.Load(fileName)
+	if err != nil {
+		b.logger.Error("读取数据总结失败，%v", err)
+		pushAndLog(b.logger, "读取数据总结失败，%v", err)
+		return
+	}
+	//每个数据总结的图片单独保存，避免同时汇总多个评论区时相互覆盖
+	imgDir := "./report/img/" + strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	files, err := analyse.Draw(summary, imgDir, b.format)
+	if err != nil {
+		b.logger.Error("绘制图表失败，%v", err)
+		pushAndLog(b.logger, "绘制图表失败，%v", err)
+		return
+	}
+	b.logger.Info("图表保存为：%s", strings.Join(files, ", "))
+	msg := summary.Message()
+	b.logger.Info("%s", msg)
+	b.logger.Info("记录的评论数：%d，楼中楼评论数：%d", summary.Board.Count, summary.Board.SubCount)
+	if b.Posting() {
+		b.postSummarize(msg, files)
+	}
+}
+
+//使用 bot 登录的账号发布数据总结动态
+func (b *Bot) postSummarize(msg string, files []string) {
+	if b.format == analyse.SVG {
+		b.logger.Warn("svg 格式的图片不能上传，只发布文字")
+		files = nil
+	}
+	pics := make([]Picture, 0, len(files))
+	for _, file := range files {
+		pic, err := b.bili.UploadImage(file)
+		if err != nil {
+			b.logger.Error("上传图片失败：%s, %v", file, err)
+			pushAndLog(b.logger, "上传图片失败：%s, %v", file, err)
+			return
+		}
+		pics = append(pics, *pic)
+	}
+	dynId, err := b.bili.PostDynamic(msg, pics)
+	if err != nil {
+		b.logger.Error("发布动态失败：%v", err)
+		pushAndLog(b.logger, "发布数据总结动态失败：%v", err)
+		return
+	}
+	b.logger.Info("发布动态成功！link: https://t.bilibili.com/%s", dynId)
+}
+
+//调用python脚本，处理数据并发布动态
+func (b *Bot) reportByPython(fileName string) {
 	var cmd *exec.Cmd
-	if b.isPost {
+	if b.Posting() {
 		cmd = exec.Command("python", "./analyse/main.py", fileName, "post")
 	} else {
 		cmd = exec.Command("python", "./analyse/main.py", fileName)
 	}
 	b.logger.Info("run python command: %s", cmd.String())
+	//脚本使用与 bot 相同的请求头
+	header, _ := json.Marshal(b.bili.client.Header())
+	cmd.Env = append(os.Environ(), "BOBO_HEADERS="+string(header))
 	cmd.Stdout = logDst
 	cmd.Stderr = logDst
 	err := cmd.Start()
@@ -495,7 +875,103 @@ func (b *Bot) ReportSummarize(fileName string) {
 	}()
 }
 
-// MonitorDynamic 动态监控 TODO
-func (b *Bot) MonitorDynamic() {
+//发布新动态后监控新动态评论区的方式
+const (
+	followNone   = ""       //不监控
+	followAdd    = "add"    //在监控之前的评论区的同时，额外监控新动态的评论区
+	followSwitch = "switch" //停止监控之前的评论区，改为监控新动态的评论区
+)
+
+//获取新动态的评论区信息失败时，每分钟重试一次，最多尝试的次数
+const followRetryMax = 5
+
+// MonitorDynamic 每分钟检查一次账号发布的动态，发现新动态时保存到数据库中并推送提醒，
+//follow 不为 followNone 时按照对应的方式监控新动态的评论区，opt 为新评论区的设置
+func MonitorDynamic(bili *BiliBili, group *BotGroup, monitor MonitorAccount,
+	opt BotOption, follow string, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	if err := bili.AccountInfo(&monitor); err != nil {
+		mainLogger.Error("获取用户信息失败！uid=%d, %v", monitor.uid, err)
+	}
+	//第一次获取到的动态只保存，不推送
+	first := true
+	//监控评论区失败的新动态和已经尝试的次数，键为动态id
+	pending := make(map[string]Dynamic)
+	tries := make(map[string]int)
+	tryFollow := func(dynamic Dynamic) {
+		if !followDynamic(bili, group, monitor, opt, follow, dynamic) {
+			if tries[dynamic.id]++; tries[dynamic.id] < followRetryMax {
+				pending[dynamic.id] = dynamic
+				return
+			}
+			mainLogger.Error("监控新动态的评论区失败，不再重试：did=%s", dynamic.id)
+		}
+		delete(pending, dynamic.id)
+		delete(tries, dynamic.id)
+	}
+	check := func(now time.Time) {
+		dynamics, _, err := bili.AccountSpace(monitor, "")
+		if err != nil {
+			mainLogger.Error("获取动态失败，uid=%d, %v", monitor.uid, err)
+			return
+		}
+		for _, dynamic := range pending {
+			tryFollow(dynamic)
+		}
+		//从旧到新处理
+		for i := len(dynamics) - 1; i >= 0; i-- {
+			dynamic := dynamics[i]
+			if !db.InsertDynamic(monitor.uid, dynamic, now.Unix()) || first {
+				continue
+			}
+			mainLogger.Info("发现新动态，uid=%d, did=%s, type=%s", monitor.uid, dynamic.id, dynamic.kind)
+			text := []rune(dynamic.text)
+			if len(text) > 100 {
+				text = append(text[:100], []rune("...")...)
+			}
+			pushAndLog(mainLogger, "[%s]\n%s发布了新动态：%s\nhttps://t.bilibili.com/%s",
+				dynamic.pubTime.Format("01-02 15:04:05"), monitor.alias, string(text), dynamic.id)
+			if follow != followNone {
+				tryFollow(dynamic)
+			}
+		}
+		first = false
+	}
+	check(time.Now())
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			check(now)
+		}
+	}
+}
 
+//监控新动态的评论区，返回 false 表示获取评论区信息失败，需要稍后重试
+func followDynamic(bili *BiliBili, group *BotGroup, monitor MonitorAccount,
+	opt BotOption, follow string, dynamic Dynamic) bool {
+	did, err := strconv.ParseUint(dynamic.id, 10, 64)
+	if err != nil {
+		mainLogger.Error("动态id错误：%s", dynamic.id)
+		return true
+	}
+	bot := NewBot(bili, Board{name: "dynamic-" + dynamic.id, dId: did}, monitor, opt)
+	if bot.board.oid == 0 {
+		//获取评论区信息失败时 NewBot 中已经推送提醒
+		return false
+	}
+	running := group.All()
+	if !group.Start(bot) {
+		return true
+	}
+	if follow == followSwitch {
+		for _, old := range running {
+			mainLogger.Info("停止监控评论区：name=%s", old.board.name)
+			group.Stop(old)
+		}
+	}
+	pushAndLog(mainLogger, "开始监控新动态的评论区：%s", bot.board.name)
+	return true
 }
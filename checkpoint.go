@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Hami-Lemon/bobo-bot/analyse"
+	"github.com/Hami-Lemon/bobo-bot/set"
+	"github.com/Hami-Lemon/bobo-bot/util"
+)
+
+//统计数据的检查点，用于程序意外退出后自动恢复
+type checkpoint struct {
+	Summary analyse.Summary `json:"summary"` //保存检查点时的统计数据
+	Last    []uint64        `json:"last"`    //最近一次获取到的评论
+}
+
+//保存检查点，调用时需要持有统计器的锁
+func (b *Bot) saveCheckpoint() {
+	cp := checkpoint{Summary: b.snapshot()}
+	b.lastLock.Lock()
+	cp.Last = b.last.Slice()
+	b.lastLock.Unlock()
+	data, err := json.Marshal(cp)
+	if err != nil {
+		b.logger.Error("保存检查点失败，%v", err)
+		return
+	}
+	db.SaveCheckpoint(b.board.oid, cp.Summary.End, data)
+	b.logger.Debug("保存检查点，oid=%d, count=%d", b.board.oid, cp.Summary.Board.Count)
+}
+
+// Resume 从数据库中该评论区最新的检查点恢复统计数据，返回保存检查点的时间
+func (b *Bot) Resume() (time.Time, bool) {
+	ctime, data, ok := db.LoadCheckpoint(b.board.oid)
+	if !ok {
+		return time.Time{}, false
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		b.logger.Error("解析检查点失败，%v", err)
+		return time.Time{}, false
+	}
+	summary := &cp.Summary
+	counter := newCounter(summary)
+	//补齐程序停止期间的数据，停止期间没有统计到评论
+	index := int(time.Now().Unix()-counter.startTime.Unix()) / 60
+	counter.hotCount, _ = util.SliceGet(counter.hotCount, index)
+	counter.awlCount, _ = util.SliceGet(counter.awlCount, index)
+	counter.pageCount, _ = util.SliceGet(counter.pageCount, index)
+	b.counter = counter
+	b.board.allCount = summary.Board.StartAllCount
+	b.board.count = summary.Board.StartCount
+	b.monitor.follower = summary.Account.StartFollowers
+	b.last = set.NewSlice(cp.Last)
+	return time.Unix(ctime, 0), true
+}
+
+//在 from 到 to 的时间段内，是否错过了生成数据汇总的时间
+func missedSummary(from, to time.Time, h, m int) bool {
+	for t := from.Truncate(time.Minute).Add(time.Minute); !t.After(to); t = t.Add(time.Minute) {
+		if (h == -1 || t.Hour() == h) && t.Minute() == m {
+			return true
+		}
+	}
+	return false
+}
@@ -2,36 +2,82 @@ package main
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/Hami-Lemon/bobo-bot/logger"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// DB 使用 SQL 数据库的 Store，评论、点赞状态等频繁写入的数据先加入写入队列，由后台协程批量写入
 type DB struct {
-	conn   *sql.DB
-	logger *logger.Logger
+	conn      *sql.DB
+	dialect   dialect
+	logger    *logger.Logger
+	stmts     map[string]*sql.Stmt //缓存的预编译语句，键为语句
+	stmtLock  sync.Mutex
+	writes    chan dbWrite  //写入队列
+	done      chan struct{} //写入协程退出后关闭
+	closed    bool          //关闭后不再接收新的数据
+	closeLock sync.RWMutex
 }
 
-// NewDB 连接数据库
+// NewDB 连接 sqlite3 数据库，并将数据库的结构升级到最新的版本
 func NewDB(dbname string) *DB {
-	_, err := os.Open(dbname)
-	isNotExist := err != nil && os.IsNotExist(err)
-	sqliteDB, err := sql.Open("sqlite3", dbname)
+	return openDB(sqliteDialect, dbname)
+}
+
+//连接 dia 类型的数据库，并将数据库的结构升级到最新的版本
+func openDB(dia dialect, source string) *DB {
+	//连接字符串中可能有密码，只在日志中输出 sqlite3 的文件名
+	name := dia.driver
+	if dia.driver == sqliteDialect.driver {
+		name = source
+	}
+	conn, err := sql.Open(dia.driver, source)
 	if err != nil {
 		mainLogger.Error("连接数据库失败！%v", err)
 		return nil
 	}
-	err = sqliteDB.Ping()
+	err = conn.Ping()
 	if err != nil {
-		mainLogger.Error("连接数据库失败！name=%s, err=%v", dbname, err)
+		mainLogger.Error("连接数据库失败！name=%s, err=%v", name, err)
+		_ = conn.Close()
 		return nil
 	}
-	mainLogger.Debug("连接 sqlite3 数据库 %s 成功", dbname)
-	if isNotExist {
-		mainLogger.Debug("创建 comment 表")
-		//建表
-		_, err = sqliteDB.Exec(`create table comment
+	mainLogger.Debug("连接 %s 数据库 %s 成功", dia.driver, name)
+	if err = migrate(conn, dia); err != nil {
+		mainLogger.Error("升级数据库失败！name=%s, err=%v", name, err)
+		_ = conn.Close()
+		return nil
+	}
+	d := &DB{
+		conn:    conn,
+		dialect: dia,
+		logger:  logger.New("db", logLevel, logDst),
+		stmts:   make(map[string]*sql.Stmt),
+		writes:  make(chan dbWrite, dbQueueSize),
+		done:    make(chan struct{}),
+	}
+	go d.writeLoop()
+	return d
+}
+
+//数据库结构的一次修改
+type migration struct {
+	desc string              //修改的内容
+	up   func(*sql.Tx) error //执行修改
+}
+
+// sqlite3 数据库结构的修改步骤，按顺序执行，第 i 个步骤执行后数据库的版本为 i+1，
+//已经发布的步骤不能再修改，新的修改只能添加在末尾
+var migrations = []migration{
+	{"创建 comment 和 follower 表", func(tx *sql.Tx) error {
+		return execAll(tx, `create table if not exists comment
 (
     id integer primary key autoincrement ,
     oid       integer, -- 评论区oid
@@ -42,66 +88,621 @@ func NewDB(dbname string) *DB {
     like_time integer, -- 点赞时间
     uid       integer, -- 评论发送者uid
     uname     text     -- 评论发送者用户名
-);`)
-		if err != nil {
-			mainLogger.Error("建立 comment 表失败，%v", err)
-			return nil
-		}
-		mainLogger.Debug("创建 follower 表")
-		_, err = sqliteDB.Exec(`create table follower
+);`, `create table if not exists follower
 (
     id    integer primary key autoincrement,
     uid   integer, -- 账号对应的uid
     ctime integer, -- 对应的时间点,时间戳形式单位秒
     fans  integer  -- 粉丝数
 );`)
+	}},
+	{"comment 表添加楼中楼以及补充获取相关的字段", func(tx *sql.Tx) error {
+		//root: 楼中楼评论所在楼的rpid，不是楼中楼则为0
+		//parent: 楼中楼评论回复的评论的rpid，不是楼中楼则为0
+		//backfill: 是否为程序启动时补充获取的评论
+		for _, column := range []string{"root", "parent", "backfill"} {
+			if err := addColumn(tx, "comment", column, "integer default 0"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"创建 checkpoint 表", func(tx *sql.Tx) error {
+		return execAll(tx, `create table if not exists checkpoint
+(
+    id    integer primary key autoincrement,
+    oid   integer, -- 评论区oid
+    ctime integer, -- 保存检查点的时间，时间戳形式单位秒
+    data  text     -- 统计数据，json格式
+);`)
+	}},
+	{"创建 dynamic 和 profile_history 表", func(tx *sql.Tx) error {
+		return execAll(tx, `create table if not exists dynamic
+(
+    id    integer primary key autoincrement,
+    uid   integer,     -- 发布动态的账号uid
+    did   text unique, -- 动态id
+    type  text,        -- 动态类型
+    msg   text,        -- 动态的文字内容
+    ptime integer,     -- 动态发布时间，时间戳形式单位秒
+    ctime integer      -- 发现该动态的时间，时间戳形式单位秒
+);`, `create table if not exists profile_history
+(
+    id    integer primary key autoincrement,
+    uid   integer, -- 账号uid
+    field text,    -- 修改的字段
+    old   text,    -- 修改前的值，第一次记录时为空
+    new   text,    -- 修改后的值
+    ctime integer  -- 发现修改的时间，时间戳形式单位秒
+);`)
+	}},
+	{"comment 表添加点赞状态相关的字段", func(tx *sql.Tx) error {
+		columns := []struct{ name, def string }{
+			{"fetch_time", "integer"},            //获取到评论的时间
+			{"like_status", "text default ''"},   //点赞状态，为空表示没有处理
+			{"like_code", "integer default 0"},   //点赞失败时的错误码
+			{"like_error", "text default ''"},    //点赞失败时的错误信息
+			{"like_retry", "integer default 0"},  //重试点赞的次数
+			{"like_update", "integer default 0"}, //点赞状态更新的时间
+		}
+		for _, c := range columns {
+			if err := addColumn(tx, "comment", c.name, c.def); err != nil {
+				return err
+			}
+		}
+		//之前的 like_time 实际上是获取到评论的时间，是否点赞未知
+		return execAll(tx,
+			`update comment set fetch_time = like_time, like_time = null where fetch_time is null`,
+			`create index if not exists comment_rpid on comment(oid, rpid)`,
+			`create index if not exists comment_like on comment(oid, like_status, like_update)`)
+	}},
+	{"comment 表添加唯一索引 (oid, rpid) 以及点赞数、回复数和删除标记", func(tx *sql.Tx) error {
+		var n int
+		err := tx.QueryRow(`select count(*) from (select 1 from comment group by oid, rpid having count(*) > 1)`).Scan(&n)
 		if err != nil {
-			mainLogger.Error("创建 follower 表失败，%v", err)
-			return nil
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("comment 表中有 %d 条评论重复，请先运行 ./bobo-bot dedupe 去除重复的评论", n)
+		}
+		columns := []struct{ name, def string }{
+			{"like_count", "integer default 0"}, //评论的点赞数
+			{"rcount", "integer default 0"},     //评论的回复数
+			{"deleted", "integer default 0"},    //评论是否已被删除
+		}
+		for _, c := range columns {
+			if err = addColumn(tx, "comment", c.name, c.def); err != nil {
+				return err
+			}
+		}
+		return execAll(tx,
+			`drop index if exists comment_rpid`,
+			`create unique index if not exists comment_oid_rpid on comment(oid, rpid)`)
+	}},
+	{"创建 summary 表", func(tx *sql.Tx) error {
+		return execAll(tx, `create table if not exists summary
+(
+    id    integer primary key autoincrement,
+    oid   integer, -- 评论区oid
+    ctime integer, -- 生成数据汇总的时间，时间戳形式单位秒
+    data  text     -- 汇总数据，json格式
+);`, `create index if not exists summary_oid on summary(oid, ctime)`)
+	}},
+}
+
+// PostgreSQL 数据库结构的修改步骤，与 sqlite3 的步骤分别计算版本，
+//第一个步骤直接创建与 sqlite3 最新版本相同的表
+var pgMigrations = []migration{
+	{"创建所有的表", func(tx *sql.Tx) error {
+		return execAll(tx, `create table if not exists comment
+(
+    id          bigserial primary key,
+    oid         bigint,                -- 评论区oid
+    type_code   integer,               -- 评论区type
+    rpid        bigint,                -- 评论rpid
+    ctime       bigint,                -- 评论发布时间
+    msg         text,                  -- 评论内容
+    like_time   bigint,                -- 点赞时间
+    uid         bigint,                -- 评论发送者uid
+    uname       text,                  -- 评论发送者用户名
+    root        bigint  default 0,     -- 楼中楼评论所在楼的rpid，不是楼中楼则为0
+    parent      bigint  default 0,     -- 楼中楼评论回复的评论的rpid，不是楼中楼则为0
+    backfill    boolean default false, -- 是否为程序启动时补充获取的评论
+    fetch_time  bigint,                -- 获取到评论的时间
+    like_status text    default '',    -- 点赞状态，为空表示没有处理
+    like_code   bigint  default 0,     -- 点赞失败时的错误码
+    like_error  text    default '',    -- 点赞失败时的错误信息
+    like_retry  integer default 0,     -- 重试点赞的次数
+    like_update bigint  default 0,     -- 点赞状态更新的时间
+    like_count  integer default 0,     -- 评论的点赞数
+    rcount      integer default 0,     -- 评论的回复数
+    deleted     integer default 0,     -- 评论是否已被删除
+    unique (oid, rpid)
+);`, `create index if not exists comment_like on comment(oid, like_status, like_update)`,
+			`create table if not exists follower
+(
+    id    bigserial primary key,
+    uid   bigint,  -- 账号对应的uid
+    ctime bigint,  -- 对应的时间点,时间戳形式单位秒
+    fans  integer  -- 粉丝数
+);`, `create table if not exists checkpoint
+(
+    id    bigserial primary key,
+    oid   bigint, -- 评论区oid
+    ctime bigint, -- 保存检查点的时间，时间戳形式单位秒
+    data  text    -- 统计数据，json格式
+);`, `create table if not exists dynamic
+(
+    id    bigserial primary key,
+    uid   bigint,      -- 发布动态的账号uid
+    did   text unique, -- 动态id
+    type  text,        -- 动态类型
+    msg   text,        -- 动态的文字内容
+    ptime bigint,      -- 动态发布时间，时间戳形式单位秒
+    ctime bigint       -- 发现该动态的时间，时间戳形式单位秒
+);`, `create table if not exists profile_history
+(
+    id    bigserial primary key,
+    uid   bigint, -- 账号uid
+    field text,   -- 修改的字段
+    old   text,   -- 修改前的值，第一次记录时为空
+    new   text,   -- 修改后的值
+    ctime bigint  -- 发现修改的时间，时间戳形式单位秒
+);`, `create table if not exists summary
+(
+    id    bigserial primary key,
+    oid   bigint, -- 评论区oid
+    ctime bigint, -- 生成数据汇总的时间，时间戳形式单位秒
+    data  text    -- 汇总数据，json格式
+);`, `create index if not exists summary_oid on summary(oid, ctime)`)
+	}},
+}
+
+//添加唯一索引后的版本，去除重复的评论需要在此之前进行
+const dedupeVersion = 6
+
+//将数据库升级到最新的版本
+func migrate(conn *sql.DB, dia dialect) error {
+	return migrateTo(conn, dia, len(dia.migrations()))
+}
+
+//将数据库升级到 target 版本，每个步骤在单独的事务中执行，失败时回滚该步骤并停止升级
+func migrateTo(conn *sql.DB, dia dialect, target int) error {
+	for {
+		done, err := migrateStep(conn, dia, target)
+		if err != nil || done {
+			return err
 		}
 	}
-	return &DB{
-		conn:   sqliteDB,
-		logger: logger.New("db", logLevel, logDst),
+}
+
+//在一个事务中执行下一个升级步骤，返回 true 表示已经是 target 版本，
+//事务开始时先获取锁再读取版本，多个程序同时升级同一个数据库时依次执行，已经执行过的步骤不会重复执行
+func migrateStep(conn *sql.DB, dia dialect, target int) (bool, error) {
+	migrations := dia.migrations()
+	tx, err := conn.Begin()
+	if err != nil {
+		return false, err
 	}
+	defer func() { _ = tx.Rollback() }()
+	if dia.lock != "" {
+		if _, err = tx.Exec(dia.lock); err != nil {
+			return false, err
+		}
+	}
+	_, err = tx.Exec(`create table if not exists schema_version
+(
+    version integer primary key, -- 执行该步骤后的版本
+    descr   text,                -- 修改的内容
+    ctime   integer              -- 执行的时间，时间戳形式单位秒
+);`)
+	if err != nil {
+		return false, err
+	}
+	version, err := schemaVersion(tx, dia)
+	if err != nil {
+		return false, err
+	}
+	if version > len(migrations) {
+		return false, fmt.Errorf("数据库的版本 %d 高于程序支持的版本 %d", version, len(migrations))
+	}
+	if version >= target {
+		return true, tx.Commit()
+	}
+	m := migrations[version]
+	mainLogger.Info("升级数据库：version=%d, %s", version+1, m.desc)
+	if err = m.up(tx); err == nil {
+		_, err = tx.Exec(dia.bind(`insert into schema_version(version, descr, ctime) values (?, ?, ?)`),
+			version+1, m.desc, time.Now().Unix())
+	}
+	if err != nil {
+		return false, fmt.Errorf("version=%d, %s: %w", version+1, m.desc, err)
+	}
+	return false, tx.Commit()
+}
+
+//可以执行查询的数据库连接或者事务
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
-// InsertComment 向数据库中插入评论数据
-func (d *DB) InsertComment(comment Comment, likeTime int64) {
-	stmt, err := d.conn.Prepare(`insert into comment
-(oid, type_code, rpid, ctime, msg, like_time, uid, uname)
-values (?, ?, ?, ?, ?, ?, ?, ?);`)
+//数据库当前的版本，没有版本记录但已经有 comment 表时，是引入版本之前创建的数据库，版本为1
+func schemaVersion(conn queryer, dia dialect) (int, error) {
+	var version sql.NullInt64
+	if err := conn.QueryRow(`select max(version) from schema_version`).Scan(&version); err != nil {
+		return 0, err
+	}
+	if version.Valid || dia.legacy == "" {
+		return int(version.Int64), nil
+	}
+	var n int
+	err := conn.QueryRow(dia.legacy).Scan(&n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	return 1, nil
+}
+
+//依次执行多条语句
+func execAll(tx *sql.Tx, stmts ...string) error {
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//如果表 table 中不存在字段 column，则添加该字段，def 为字段的类型定义
+func addColumn(tx *sql.Tx, table, column, def string) error {
+	rows, err := tx.Query(fmt.Sprintf("pragma table_info(%s)", table))
 	if err != nil {
-		d.logger.Error("InsertComment: prepare, %v", err)
-		return
+		return err
 	}
-	_, err = stmt.Exec(comment.oid, comment.typeCode, comment.replyId,
-		comment.ctime, comment.msg, likeTime, comment.uid, comment.uname)
+	exist := false
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err = rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		if name == column {
+			exist = true
+		}
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil || exist {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("alter table %s add column %s %s", table, column, def))
+	return err
+}
+
+// InsertComment 向数据库中插入评论数据，fetchTime 为获取到该评论的时间，
+//评论已经存在时只更新用户名、点赞数、回复数和删除标记，数据在后台写入
+func (d *DB) InsertComment(comment Comment, fetchTime int64) {
+	d.enqueue(dbWrite{
+		name: "InsertComment",
+		query: `insert into comment
+(oid, type_code, rpid, ctime, msg, fetch_time, uid, uname, root, parent, backfill, like_count, rcount, deleted)
+values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, case when ? then 1 else 0 end)
+on conflict (oid, rpid) do update set uname = excluded.uname, like_count = excluded.like_count,
+rcount = excluded.rcount, deleted = excluded.deleted;`,
+		args: []interface{}{comment.oid, comment.typeCode, comment.replyId,
+			comment.ctime, comment.msg, fetchTime, comment.uid, comment.uname,
+			comment.root, comment.parent, comment.backfill, comment.like, comment.rcount, comment.deleted},
+	})
+}
+
+//评论的点赞状态
+const (
+	likeSkipped = "skipped" //规则不点赞或者关闭了点赞
+	likeQueued  = "queued"  //已加入点赞任务队列
+	likeDropped = "dropped" //任务队列已满或者登录状态失效，没有加入队列，等待重试
+	likeLiked   = "liked"   //点赞成功
+	likeFailed  = "failed"  //点赞失败，等待重试
+	likeDeleted = "deleted" //评论已被删除，不再点赞
+)
+
+// UpdateLike 更新评论的点赞状态，err 为点赞失败或者没有加入任务队列的原因，点赞成功时记录点赞时间，数据在后台写入
+func (d *DB) UpdateLike(comment Comment, status string, err error, now int64) {
+	var (
+		code int64
+		msg  string
+	)
 	if err != nil {
-		d.logger.Error("InsertComment: exec, %v", err)
-		return
+		msg = err.Error()
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			code = apiErr.Code
+			if code == 0 {
+				code = int64(apiErr.Status)
+			}
+		}
 	}
-	d.logger.Debug("InsertComment 成功，oid=%d, rpid=%d, msg=%s",
-		comment.oid, comment.replyId, comment.msg)
+	//点赞成功时记录点赞时间，评论已被删除时记录删除标记
+	d.enqueue(dbWrite{
+		name: "UpdateLike",
+		query: `update comment set like_status = ?, like_code = ?, like_error = ?, like_update = ?,
+like_time = case when ? then ? else like_time end, deleted = case when ? then 1 else deleted end
+where oid = ? and rpid = ?`,
+		args: []interface{}{status, code, msg, now, status == likeLiked, now, status == likeDeleted,
+			comment.oid, comment.replyId},
+	})
 }
 
-// InsertFollower 插入粉丝数
+// RetryLikes 获取评论区 oid 中需要重新点赞的评论并增加其重试次数，
+//即点赞失败或者没有加入任务队列，状态在 before 之前更新，在 since 之后获取到，并且重试次数小于 maxRetry 的评论，最多 limit 条
+func (d *DB) RetryLikes(oid uint64, before, since int64, maxRetry, limit int) []Comment {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		d.logger.Error("RetryLikes: begin, %v", err)
+		return nil
+	}
+	rows, err := tx.Query(d.dialect.bind(`select id, oid, type_code, rpid, ctime, msg, uid, uname, root, parent from comment
+where oid = ? and like_status in (?, ?) and like_update <= ? and fetch_time >= ? and like_retry < ? and deleted = 0
+order by rpid limit ?`), oid, likeFailed, likeDropped, before, since, maxRetry, limit)
+	if err != nil {
+		_ = tx.Rollback()
+		d.logger.Error("RetryLikes: query, %v", err)
+		return nil
+	}
+	var (
+		ids      []int64
+		comments []Comment
+	)
+	for rows.Next() {
+		var (
+			id int64
+			c  Comment
+		)
+		err = rows.Scan(&id, &c.oid, &c.typeCode, &c.replyId, &c.ctime, &c.msg, &c.uid, &c.uname, &c.root, &c.parent)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+		comments = append(comments, c)
+	}
+	_ = rows.Close()
+	if err == nil {
+		err = rows.Err()
+	}
+	for _, id := range ids {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec(d.dialect.bind(`update comment set like_retry = like_retry + 1 where id = ?`), id)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		d.logger.Error("RetryLikes: exec, %v", err)
+		return nil
+	}
+	if err = tx.Commit(); err != nil {
+		d.logger.Error("RetryLikes: commit, %v", err)
+		return nil
+	}
+	return comments
+}
+
+// InsertFollower 插入粉丝数，数据在后台写入
 func (d *DB) InsertFollower(uid uint64, ctime int64, fans int) {
-	stmt, err := d.conn.Prepare(`insert into follower(uid, ctime, fans)
-values (?, ?, ?)`)
+	d.enqueue(dbWrite{
+		name:  "InsertFollower",
+		query: `insert into follower(uid, ctime, fans) values (?, ?, ?)`,
+		args:  []interface{}{uid, ctime, fans},
+	})
+}
+
+// InsertDynamic 插入账号 uid 发布的动态，返回该动态之前是否不存在于数据库中
+func (d *DB) InsertDynamic(uid uint64, dynamic Dynamic, ctime int64) bool {
+	stmt, err := d.prepared(`insert into dynamic(uid, did, type, msg, ptime, ctime)
+values (?, ?, ?, ?, ?, ?) on conflict (did) do nothing`)
 	if err != nil {
-		d.logger.Error("InsertFollower: prepare, %v", err)
-		return
+		d.logger.Error("InsertDynamic: prepare, %v", err)
+		return false
 	}
-	_, err = stmt.Exec(uid, ctime, fans)
+	result, err := stmt.Exec(uid, dynamic.id, dynamic.kind, dynamic.text, dynamic.pubTime.Unix(), ctime)
 	if err != nil {
-		d.logger.Error("InsertFollower: exec, %v", err)
-		return
+		d.logger.Error("InsertDynamic: exec, %v", err)
+		return false
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		d.logger.Error("InsertDynamic: rows affected, %v", err)
+		return false
+	}
+	if n > 0 {
+		d.logger.Debug("InsertDynamic 成功，uid=%d, did=%s", uid, dynamic.id)
+	}
+	return n > 0
+}
+
+// LastProfile 获取账号 uid 每个个人资料字段最近一次记录的值，键为字段名
+func (d *DB) LastProfile(uid uint64) map[string]string {
+	profile := make(map[string]string)
+	rows, err := d.conn.Query(d.dialect.bind(`select field, new from profile_history
+where id in (select max(id) from profile_history where uid = ? group by field)`), uid)
+	if err != nil {
+		d.logger.Error("LastProfile: query, %v", err)
+		return profile
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var field, value string
+		if err = rows.Scan(&field, &value); err != nil {
+			d.logger.Error("LastProfile: scan, %v", err)
+			return profile
+		}
+		profile[field] = value
+	}
+	return profile
+}
+
+// InsertProfileChange 记录账号 uid 个人资料的修改，数据在后台写入
+func (d *DB) InsertProfileChange(uid uint64, change profileChange, ctime int64) {
+	d.enqueue(dbWrite{
+		name:  "InsertProfileChange",
+		query: `insert into profile_history(uid, field, old, new, ctime) values (?, ?, ?, ?, ?)`,
+		args:  []interface{}{uid, change.field, change.old, change.new, ctime},
+	})
+}
+
+// NewestComment 获取评论区 oid 中最新的一条评论（不含楼中楼）的 rpid 和发布时间
+func (d *DB) NewestComment(oid uint64) (uint64, uint64, bool) {
+	var rpid, ctime uint64
+	err := d.conn.QueryRow(d.dialect.bind(`select rpid, ctime from comment
+where oid = ? and (root = 0 or root is null) order by rpid desc limit 1`), oid).Scan(&rpid, &ctime)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			d.logger.Error("NewestComment: query, %v", err)
+		}
+		return 0, 0, false
 	}
-	d.logger.Debug("InsertFollower 成功， uid=%d, ctime=%d, fans=%d", uid, ctime, fans)
+	return rpid, ctime, true
+}
+
+// SaveCheckpoint 保存评论区 oid 的检查点，只保留最新的检查点，数据在后台写入
+func (d *DB) SaveCheckpoint(oid uint64, ctime int64, data []byte) {
+	//同一批数据按顺序在同一个事务中写入
+	d.enqueue(dbWrite{
+		name:  "SaveCheckpoint",
+		query: `insert into checkpoint(oid, ctime, data) values (?, ?, ?)`,
+		args:  []interface{}{oid, ctime, string(data)},
+	})
+	d.enqueue(dbWrite{
+		name:  "SaveCheckpoint",
+		query: `delete from checkpoint where oid = ? and id < (select max(id) from checkpoint where oid = ?)`,
+		args:  []interface{}{oid, oid},
+	})
 }
 
+// LoadCheckpoint 获取评论区 oid 最新的检查点
+func (d *DB) LoadCheckpoint(oid uint64) (int64, []byte, bool) {
+	var (
+		ctime int64
+		data  string
+	)
+	err := d.conn.QueryRow(d.dialect.bind(`select ctime, data from checkpoint where oid = ? order by id desc limit 1`), oid).
+		Scan(&ctime, &data)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			d.logger.Error("LoadCheckpoint: query, %v", err)
+		}
+		return 0, nil, false
+	}
+	return ctime, []byte(data), true
+}
+
+// SaveSummary 保存评论区 oid 的数据汇总，数据在后台写入
+func (d *DB) SaveSummary(oid uint64, ctime int64, data []byte) {
+	d.enqueue(dbWrite{
+		name:  "SaveSummary",
+		query: `insert into summary(oid, ctime, data) values (?, ?, ?)`,
+		args:  []interface{}{oid, ctime, string(data)},
+	})
+}
+
+// Close 写入队列中剩余的数据后断开连接
 func (d *DB) Close() {
+	d.closeLock.Lock()
+	if d.closed {
+		d.closeLock.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.writes)
+	d.closeLock.Unlock()
+	<-d.done
+	d.stmtLock.Lock()
+	for _, stmt := range d.stmts {
+		_ = stmt.Close()
+	}
+	d.stmtLock.Unlock()
 	d.logger.Debug("断开连接")
 	_ = d.conn.Close()
 }
+
+//去除 comment 表中 oid 和 rpid 相同的重复评论，每组保留点赞成功的或者最早插入的一条，返回删除的评论数
+func dedupeComments(conn *sql.DB) (int64, error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`delete from comment where id not in (
+    select id from (
+        select id, row_number() over (
+            partition by oid, rpid order by like_status = 'liked' desc, id
+        ) as n from comment
+    ) where n = 1
+)`)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+//将文件 src 复制到 dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+//dedupe 子命令，备份数据库文件后去除重复的评论，并将数据库升级到最新的版本，
+//数据库文件为命令的第一个参数，没有参数时使用设置文件中的 dbname，只支持 sqlite3 数据库
+func dedupe(dbname string) error {
+	if dbname == "" {
+		setting, err := loadSetting()
+		if err != nil {
+			return err
+		}
+		if driver := setting.Get("config.dbdriver").String(); driver != "" && driver != sqliteDialect.driver {
+			return fmt.Errorf("dedupe 只支持 sqlite3 数据库，当前为 %s", driver)
+		}
+		dbname = setting.Get("config.dbname").String()
+	}
+	backup := fmt.Sprintf("%s.%s.bak", dbname, time.Now().Format("20060102150405"))
+	if err := copyFile(dbname, backup); err != nil {
+		return fmt.Errorf("备份数据库失败：%w", err)
+	}
+	mainLogger.Info("已备份数据库：%s", backup)
+	conn, err := sql.Open("sqlite3", dbname)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	//去除重复的评论时需要点赞状态相关的字段
+	if err = migrateTo(conn, sqliteDialect, dedupeVersion-1); err != nil {
+		return err
+	}
+	n, err := dedupeComments(conn)
+	if err != nil {
+		return err
+	}
+	mainLogger.Info("删除重复的评论：%d 条", n)
+	return migrate(conn, sqliteDialect)
+}
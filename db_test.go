@@ -0,0 +1,331 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//引入版本之前的程序创建数据库时使用的语句
+const v1Schema = `create table comment
+(
+    id integer primary key autoincrement ,
+    oid       integer, -- 评论区oid
+    type_code integer, -- 评论区type
+    rpid      integer, -- 评论rpid
+    ctime     integer, -- 评论发布时间
+    msg       text,    -- 评论内容
+    like_time integer, -- 点赞时间
+    uid       integer, -- 评论发送者uid
+    uname     text     -- 评论发送者用户名
+);
+create table follower
+(
+    id    integer primary key autoincrement,
+    uid   integer, -- 账号对应的uid
+    ctime integer, -- 对应的时间点,时间戳形式单位秒
+    fans  integer  -- 粉丝数
+);`
+
+//表 table 的所有字段
+func columns(t *testing.T, conn *sql.DB, table string) map[string]bool {
+	t.Helper()
+	rows, err := conn.Query("select name from pragma_table_info(?)", table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names[name] = true
+	}
+	return names
+}
+
+func checkSchema(t *testing.T, d *DB) {
+	t.Helper()
+	version, err := schemaVersion(d.conn, d.dialect)
+	if err != nil || version != len(migrations) {
+		t.Fatalf("version got: %d, %v, except: %d", version, err, len(migrations))
+	}
+	for table, want := range map[string][]string{
+		"comment":         {"rpid", "root", "parent", "backfill", "fetch_time", "like_status", "like_count", "rcount", "deleted"},
+		"follower":        {"fans"},
+		"checkpoint":      {"data"},
+		"dynamic":         {"did"},
+		"profile_history": {"field", "old", "new"},
+		"summary":         {"oid", "data"},
+	} {
+		got := columns(t, d.conn, table)
+		for _, column := range want {
+			if !got[column] {
+				t.Errorf("table %s missing column %s, got: %v", table, column, got)
+			}
+		}
+	}
+}
+
+func TestMigrateV1(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "v1.db")
+	conn, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Exec(v1Schema); err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(`insert into comment(oid, type_code, rpid, ctime, msg, like_time, uid, uname)
+values (1, 11, 100, 1650000000, 'hello', 0, 10, 'user')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	d := NewDB(file)
+	if d == nil {
+		t.Fatal("NewDB failed")
+	}
+	checkSchema(t, d)
+	//原有的数据保留，新字段使用默认值
+	var (
+		msg                    string
+		root, parent, backfill int
+	)
+	err = d.conn.QueryRow(`select msg, root, parent, backfill from comment where rpid = 100`).
+		Scan(&msg, &root, &parent, &backfill)
+	if err != nil || msg != "hello" || root != 0 || parent != 0 || backfill != 0 {
+		t.Errorf("got: %s %d %d %d, %v", msg, root, parent, backfill, err)
+	}
+	//之前的 like_time 是获取到评论的时间
+	var (
+		fetchTime int64
+		likeTime  sql.NullInt64
+	)
+	err = d.conn.QueryRow(`select fetch_time, like_time from comment where rpid = 100`).Scan(&fetchTime, &likeTime)
+	if err != nil || fetchTime != 0 || likeTime.Valid {
+		t.Errorf("got: fetch_time=%d, like_time=%v, %v", fetchTime, likeTime, err)
+	}
+	d.Close()
+
+	//再次打开时不重复升级
+	d = NewDB(file)
+	if d == nil {
+		t.Fatal("NewDB failed")
+	}
+	defer d.Close()
+	var n int
+	if err = d.conn.QueryRow(`select count(*) from schema_version`).Scan(&n); err != nil || n != len(migrations)-1 {
+		t.Errorf("schema_version rows got: %d, %v, except: %d", n, err, len(migrations)-1)
+	}
+}
+
+func TestMigrateFresh(t *testing.T) {
+	d := NewDB(filepath.Join(t.TempDir(), "fresh.db"))
+	if d == nil {
+		t.Fatal("NewDB failed")
+	}
+	defer d.Close()
+	checkSchema(t, d)
+}
+
+func TestMigrateFailure(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "fail.db")
+	old := migrations
+	defer func() { migrations = old }()
+	migrations = append(migrations[:len(migrations):len(migrations)], migration{"错误的步骤", func(tx *sql.Tx) error {
+		return execAll(tx, `create table broken(id integer)`, `not a statement`)
+	}})
+	if d := NewDB(file); d != nil {
+		d.Close()
+		t.Fatal("NewDB should fail")
+	}
+	//失败的步骤回滚，之前的步骤保留
+	migrations = old
+	d := NewDB(file)
+	if d == nil {
+		t.Fatal("NewDB failed")
+	}
+	defer d.Close()
+	checkSchema(t, d)
+	if got := columns(t, d.conn, "broken"); len(got) != 0 {
+		t.Errorf("broken table exists: %v", got)
+	}
+}
+
+func TestLikeLifecycle(t *testing.T) {
+	d := NewDB(filepath.Join(t.TempDir(), "like.db"))
+	if d == nil {
+		t.Fatal("NewDB failed")
+	}
+	defer d.Close()
+	status := func(rpid uint64) (string, int64, int) {
+		var (
+			s     string
+			code  int64
+			retry int
+		)
+		err := d.conn.QueryRow(`select like_status, like_code, like_retry from comment where rpid = ?`, rpid).
+			Scan(&s, &code, &retry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s, code, retry
+	}
+	const now = 1660000000
+	liked := Comment{oid: 1, typeCode: 11, replyId: 100, msg: "liked"}
+	failed := Comment{oid: 1, typeCode: 11, replyId: 101, msg: "failed"}
+	old := Comment{oid: 1, typeCode: 11, replyId: 102, msg: "old"}
+	d.InsertComment(liked, now)
+	d.InsertComment(failed, now)
+	d.InsertComment(old, now-int64(likeRetryAge/time.Second)-1)
+
+	d.UpdateLike(liked, likeQueued, nil, now)
+	d.UpdateLike(liked, likeLiked, nil, now+1)
+	d.Flush()
+	if s, _, _ := status(100); s != likeLiked {
+		t.Errorf("status got: %s, except: %s", s, likeLiked)
+	}
+	var likeTime int64
+	if err := d.conn.QueryRow(`select like_time from comment where rpid = 100`).Scan(&likeTime); err != nil || likeTime != now+1 {
+		t.Errorf("like_time got: %d, %v", likeTime, err)
+	}
+
+	d.UpdateLike(failed, likeFailed, &APIError{Code: 12015, Message: "需要输入验证码"}, now)
+	d.UpdateLike(old, likeDropped, errLikeQueueFull, now)
+	d.Flush()
+	if s, code, _ := status(101); s != likeFailed || code != 12015 {
+		t.Errorf("got: %s %d", s, code)
+	}
+	cooldown := int64(likeRetryCooldown / time.Second)
+	since := int64(now - likeRetryAge/time.Second)
+	//冷却时间内不重试
+	if got := d.RetryLikes(1, now-cooldown, since, likeRetryMax, 10); len(got) != 0 {
+		t.Errorf("got: %v, except: []", got)
+	}
+	for i := 1; i <= likeRetryMax; i++ {
+		got := d.RetryLikes(1, now+cooldown, since, likeRetryMax, 10)
+		if len(got) != 1 || got[0].replyId != 101 || got[0].typeCode != 11 {
+			t.Fatalf("retry %d got: %+v", i, got)
+		}
+		if _, _, retry := status(101); retry != i {
+			t.Errorf("retry got: %d, except: %d", retry, i)
+		}
+	}
+	//达到重试次数上限后不再重试
+	if got := d.RetryLikes(1, now+cooldown, since, likeRetryMax, 10); len(got) != 0 {
+		t.Errorf("got: %v, except: []", got)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dup.db")
+	conn, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Exec(v1Schema); err != nil {
+		t.Fatal(err)
+	}
+	for _, rpid := range []int{100, 100, 101, 101, 101, 102} {
+		_, err = conn.Exec(`insert into comment(oid, type_code, rpid, ctime, msg, like_time, uid, uname)
+values (1, 11, ?, 1650000000, 'hello', 0, 10, 'user')`, rpid)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = conn.Close()
+	//有重复的评论时不能升级
+	if d := NewDB(file); d != nil {
+		d.Close()
+		t.Fatal("NewDB should fail with duplicate comments")
+	}
+	if err = dedupe(file); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := filepath.Glob(file + ".*.bak"); len(backups) != 1 {
+		t.Errorf("backups: %v", backups)
+	}
+	d := NewDB(file)
+	if d == nil {
+		t.Fatal("NewDB failed")
+	}
+	defer d.Close()
+	checkSchema(t, d)
+	var n int
+	if err = d.conn.QueryRow(`select count(*) from comment`).Scan(&n); err != nil || n != 3 {
+		t.Errorf("comments got: %d, %v, except: 3", n, err)
+	}
+	//再次插入时只更新点赞数和回复数
+	comment := Comment{Account: Account{uid: 10, uname: "renamed"}, oid: 1, typeCode: 11, replyId: 100, like: 5, rcount: 2}
+	d.InsertComment(comment, 1660000000)
+	d.Flush()
+	var (
+		uname            string
+		like, rcount     int
+		fetchTime, nRpid int64
+	)
+	err = d.conn.QueryRow(`select count(*), uname, like_count, rcount, fetch_time from comment where rpid = 100`).
+		Scan(&nRpid, &uname, &like, &rcount, &fetchTime)
+	if err != nil || nRpid != 1 || uname != "renamed" || like != 5 || rcount != 2 || fetchTime != 0 {
+		t.Errorf("got: %d %s %d %d %d, %v", nRpid, uname, like, rcount, fetchTime, err)
+	}
+}
+
+func TestWriteQueue(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "queue.db")
+	d := NewDB(file)
+	if d == nil {
+		t.Fatal("NewDB failed")
+	}
+	n := dbBatchSize*2 + 1
+	for i := 0; i < n; i++ {
+		d.InsertComment(Comment{oid: 1, typeCode: 11, replyId: uint64(i)}, 1660000000)
+	}
+	d.InsertFollower(10, 1660000000, 100)
+	//关闭时写入队列中剩余的数据，之后的写入被丢弃
+	d.Close()
+	d.InsertFollower(10, 1660000001, 101)
+	d.Close()
+
+	d = NewDB(file)
+	if d == nil {
+		t.Fatal("NewDB failed")
+	}
+	defer d.Close()
+	var comments, fans int
+	if err := d.conn.QueryRow(`select count(*) from comment`).Scan(&comments); err != nil || comments != n {
+		t.Errorf("comments got: %d, %v, except: %d", comments, err, n)
+	}
+	if err := d.conn.QueryRow(`select count(*) from follower`).Scan(&fans); err != nil || fans != 1 {
+		t.Errorf("followers got: %d, %v, except: 1", fans, err)
+	}
+}
+
+func TestWriteBatchFailure(t *testing.T) {
+	d := NewDB(filepath.Join(t.TempDir(), "batch.db"))
+	if d == nil {
+		t.Fatal("NewDB failed")
+	}
+	defer d.Close()
+	d.InsertFollower(10, 1660000000, 100)
+	//版本1已经存在，主键冲突导致写入失败
+	d.enqueue(dbWrite{
+		name:  "broken",
+		query: `insert into schema_version(version, descr, ctime) values (?, ?, ?)`,
+		args:  []interface{}{1, "broken", 0},
+	})
+	d.InsertFollower(10, 1660000001, 101)
+	d.Flush()
+	var n int
+	if err := d.conn.QueryRow(`select count(*) from follower`).Scan(&n); err != nil || n != 2 {
+		t.Errorf("followers got: %d, %v, except: 2", n, err)
+	}
+	if err := d.conn.QueryRow(`select count(*) from schema_version where descr = 'broken'`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("broken write got: %d, %v, except: 0", n, err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	dbQueueSize  = 4096        //写入队列的容量
+	dbBatchSize  = 128         //队列中等待写入的数据达到该数量时立即写入
+	dbBatchDelay = time.Second //数据最多在队列中等待的时间
+)
+
+//等待写入数据库的一条数据
+type dbWrite struct {
+	name    string        //写入的操作，用于日志
+	query   string        //执行的语句
+	args    []interface{} //语句的参数
+	flushed chan struct{} //不为 nil 时表示 Flush 的标记，之前的数据写入后关闭
+}
+
+//获取预编译的语句，语句在第一次使用时编译，之后一直缓存到数据库关闭
+func (d *DB) prepared(query string) (*sql.Stmt, error) {
+	d.stmtLock.Lock()
+	defer d.stmtLock.Unlock()
+	if stmt, ok := d.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := d.conn.Prepare(d.dialect.bind(query))
+	if err != nil {
+		return nil, err
+	}
+	d.stmts[query] = stmt
+	return stmt, nil
+}
+
+//将数据加入写入队列，队列已满时等待
+func (d *DB) enqueue(w dbWrite) {
+	d.closeLock.RLock()
+	defer d.closeLock.RUnlock()
+	if d.closed {
+		d.logger.Error("%s: 数据库已关闭，丢弃该数据", w.name)
+		if w.flushed != nil {
+			close(w.flushed)
+		}
+		return
+	}
+	select {
+	case d.writes <- w:
+	default:
+		d.logger.Warn("数据库写入队列已满，等待写入")
+		d.writes <- w
+	}
+}
+
+//在后台批量写入队列中的数据，每批数据在同一个事务中写入，队列关闭后写入剩余的数据并退出
+func (d *DB) writeLoop() {
+	defer close(d.done)
+	batch := make([]dbWrite, 0, dbBatchSize)
+	var timeout <-chan time.Time
+	flush := func() {
+		if len(batch) > 0 {
+			d.writeBatch(batch)
+			batch = batch[:0]
+		}
+		timeout = nil
+	}
+	for {
+		select {
+		case w, ok := <-d.writes:
+			if !ok {
+				flush()
+				return
+			}
+			if w.flushed != nil {
+				flush()
+				close(w.flushed)
+				continue
+			}
+			batch = append(batch, w)
+			if timeout == nil {
+				timeout = time.After(dbBatchDelay)
+			}
+			if len(batch) >= dbBatchSize {
+				flush()
+			}
+		case <-timeout:
+			flush()
+		}
+	}
+}
+
+//写入一批数据，先在一个事务中写入整批数据，其中有数据写入失败时回滚整个事务，
+//再逐条在单独的事务中重新写入，写入失败的数据不影响其它数据
+func (d *DB) writeBatch(batch []dbWrite) {
+	err := d.execBatch(batch)
+	if err == nil {
+		d.logger.Debug("写入数据：%d 条", len(batch))
+		return
+	}
+	if len(batch) == 1 {
+		d.logger.Error("writeBatch: %v", err)
+		return
+	}
+	d.logger.Warn("批量写入失败，逐条重新写入：%v", err)
+	for _, w := range batch {
+		if err = d.execBatch([]dbWrite{w}); err != nil {
+			d.logger.Error("writeBatch: %v", err)
+		}
+	}
+}
+
+//在一个事务中写入 batch，任意一条数据写入失败时回滚整个事务，
+//PostgreSQL 中语句执行失败后事务中之后的语句都会失败，所以不能跳过失败的数据继续写入
+func (d *DB) execBatch(batch []dbWrite) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("begin, %w", err)
+	}
+	for _, w := range batch {
+		stmt, err := d.prepared(w.query)
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("%s: prepare, %w", w.name, err)
+		}
+		if _, err = tx.Stmt(stmt).Exec(w.args...); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("%s: exec, %w", w.name, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit, %w", err)
+	}
+	return nil
+}
+
+// Flush 等待写入队列中现有的数据全部写入
+func (d *DB) Flush() {
+	flushed := make(chan struct{})
+	d.enqueue(dbWrite{name: "Flush", flushed: flushed})
+	<-flushed
+}
@@ -4,11 +4,18 @@ go 1.18
 
 require (
 	github.com/andybalholm/brotli v1.0.4
+	github.com/hajimehoshi/bitmapfont/v3 v3.2.0
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.13
-	github.com/tidwall/gjson v1.14.1
+	github.com/tidwall/gjson v1.14.2
+	github.com/tidwall/sjson v1.2.5
+	golang.org/x/image v0.20.0
+	rsc.io/qr v0.2.0
 )
 
 require (
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.0 // indirect
+	golang.org/x/text v0.18.0 // indirect
 )
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+)
+
+// BotGroup 正在运行的 bot，运行时可以添加新的 bot 或者停止其中的 bot
+type BotGroup struct {
+	lock    sync.Mutex
+	bots    []*Bot
+	wg      sync.WaitGroup
+	stopped bool //停止后不能再添加 bot
+}
+
+// Start 开始监控 bot 的评论区，bot 停止后生成数据汇总，返回 false 表示已经停止，bot 没有启动
+func (g *BotGroup) Start(bot *Bot) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.stopped {
+		return false
+	}
+	mainLogger.Info("监控评论区：name=%s, did=%d, bv=%s", bot.board.name, bot.board.dId, bot.board.bvID)
+	g.bots = append(g.bots, bot)
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		bot.Monitor()
+		bot.Summarize()
+	}()
+	return true
+}
+
+// All 正在运行的 bot 的副本
+func (g *BotGroup) All() []*Bot {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	bots := make([]*Bot, len(g.bots))
+	copy(bots, g.bots)
+	return bots
+}
+
+// Stop 停止指定的 bot，bot 为 nil 时停止所有的 bot，并且之后不能再添加
+func (g *BotGroup) Stop(bot *Bot) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if bot == nil {
+		g.stopped = true
+	}
+	running := g.bots[:0]
+	for _, b := range g.bots {
+		if bot == nil || b == bot {
+			b.Stop()
+		} else {
+			running = append(running, b)
+		}
+	}
+	g.bots = running
+}
+
+// Wait 等待所有的 bot 结束
+func (g *BotGroup) Wait() {
+	g.wg.Wait()
+}
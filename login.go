@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hami-Lemon/bobo-bot/request"
+	"github.com/tidwall/sjson"
+	"rsc.io/qr"
+)
+
+//扫码登录的接口地址，测试时替换为本地的服务
+var passportURL = "https://passport.bilibili.com"
+
+//扫码登录的状态码
+const (
+	qrSuccess    = 0     //登录成功
+	qrExpired    = 86038 //二维码已失效
+	qrConfirming = 86090 //已扫码，未确认
+	qrWaiting    = 86101 //未扫码
+)
+
+var (
+	// ErrQRExpired 二维码已失效
+	ErrQRExpired = errors.New("二维码已失效")
+)
+
+//申请二维码，返回二维码的内容和用于轮询登录状态的 key
+func generateQR(client *request.Client) (string, string, error) {
+	urlStr := passportURL + "/x/passport-login/web/qrcode/generate"
+	data, err := checkResp(client.Get(urlStr, nil, nil))
+	if err != nil {
+		return "", "", err
+	}
+	return data.Get("url").String(), data.Get("qrcode_key").String(), nil
+}
+
+//查询扫码状态，返回状态码，登录成功时返回登录账号的 cookie 和 refresh_token
+func pollQR(client *request.Client, key string) (int, BotAccount, error) {
+	urlStr := passportURL + "/x/passport-login/web/qrcode/poll"
+	params := map[string]interface{}{
+		"qrcode_key": key,
+	}
+	data, err := checkResp(client.Get(urlStr, params, nil))
+	if err != nil {
+		return 0, BotAccount{}, err
+	}
+	code := int(data.Get("code").Int())
+	if code != qrSuccess {
+		return code, BotAccount{}, nil
+	}
+	//登录成功后返回的跨域地址中带有 cookie
+	u, err := url.Parse(data.Get("url").String())
+	if err != nil {
+		return code, BotAccount{}, err
+	}
+	query := u.Query()
+	acc := BotAccount{
+		uidMd5:   query.Get(DedeUserIDMd5),
+		sessData: query.Get(SessData),
+		csrf:     query.Get(Csrf),
+		sid:      query.Get(SId),
+
+		refreshToken: data.Get("refresh_token").String(),
+	}
+	acc.uid, err = strconv.ParseUint(query.Get(DedeUserID), 10, 64)
+	if err != nil || acc.sessData == "" || acc.csrf == "" {
+		return code, BotAccount{}, fmt.Errorf("登录成功但无法获取 cookie：%s", u.RawQuery)
+	}
+	return code, acc, nil
+}
+
+//扫码登录，二维码输出到 out 中，每隔 interval 查询一次扫码状态，直到登录成功或者二维码失效
+func loginByQR(out io.Writer, interval time.Duration) (BotAccount, error) {
+	client := request.New(browserHeader, map[string]string{}, 5)
+	content, key, err := generateQR(client)
+	if err != nil {
+		return BotAccount{}, fmt.Errorf("申请二维码失败：%w", err)
+	}
+	if err = renderQR(out, content); err != nil {
+		return BotAccount{}, err
+	}
+	_, _ = fmt.Fprintf(out, "请使用哔哩哔哩客户端扫描二维码登录，如果无法扫描，可以将以下链接转换为二维码：\n%s\n", content)
+	last := -1
+	for {
+		code, acc, err := pollQR(client, key)
+		if err != nil {
+			return BotAccount{}, fmt.Errorf("查询扫码状态失败：%w", err)
+		}
+		switch code {
+		case qrSuccess:
+			return acc, nil
+		case qrExpired:
+			return BotAccount{}, ErrQRExpired
+		case qrConfirming:
+			if last != code {
+				_, _ = fmt.Fprintln(out, "已扫码，请在客户端中确认登录")
+			}
+		}
+		last = code
+		time.Sleep(interval)
+	}
+}
+
+//以文本的形式输出二维码，每个字符表示上下两个模块，深色终端下显示正常
+func renderQR(out io.Writer, content string) error {
+	code, err := qr.Encode(content, qr.L)
+	if err != nil {
+		return err
+	}
+	const quiet = 2 //二维码四周的空白
+	//终端背景为深色，亮色的模块使用方块字符显示
+	light := func(x, y int) bool {
+		return !code.Black(x-quiet, y-quiet)
+	}
+	size := code.Size + quiet*2
+	sb := strings.Builder{}
+	for y := 0; y < size; y += 2 {
+		for x := 0; x < size; x++ {
+			top, bottom := light(x, y), y+1 < size && light(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	_, err = io.WriteString(out, sb.String())
+	return err
+}
+
+//将登录账号的 cookie 写入设置文件的 botAccount 中，其它设置保持不变，
+//先写入临时文件再重命名，避免写入过程中程序退出导致设置文件损坏
+func saveAccount(file string, acc BotAccount) error {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		data = []byte("{}")
+	} else if err != nil {
+		return err
+	}
+	type field struct {
+		path  string
+		value interface{}
+	}
+	fields := []field{
+		{"botAccount.uid", acc.uid},
+		{"botAccount.uidMd5", acc.uidMd5},
+		{"botAccount.sessData", acc.sessData},
+		{"botAccount.csrf", acc.csrf},
+		{"botAccount.refreshToken", acc.refreshToken},
+	}
+	//扫码登录时可能没有 sid，保留原来的值
+	if acc.sid != "" {
+		fields = append(fields, field{"botAccount.sid", acc.sid})
+	}
+	for _, f := range fields {
+		data, err = sjson.SetBytes(data, f.path, f.value)
+		if err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(file, data)
+}
+
+//写入临时文件后重命名为 file，保留原文件的权限
+func writeFileAtomic(file string, data []byte) error {
+	perm := os.FileMode(0o600)
+	if stat, err := os.Stat(file); err == nil {
+		perm = stat.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+//login 子命令，扫码登录并将 cookie 写入设置文件
+func login() {
+	//使用设置中的请求头配置，没有设置文件时使用默认配置
+	if setting, err := loadSetting(); err == nil {
+		if err = readProfile(setting); err != nil {
+			mainLogger.Error("读取请求头配置失败，%v", err)
+			return
+		}
+	}
+	acc, err := loginByQR(os.Stdout, 2*time.Second)
+	if err != nil {
+		mainLogger.Error("登录失败，%v", err)
+		return
+	}
+	if err = saveAccount(settingFile, acc); err != nil {
+		mainLogger.Error("写入设置失败，%v", err)
+		return
+	}
+	mainLogger.Info("登录成功，uid=%d，cookie 已写入 %s", acc.uid, settingFile)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+//模拟扫码登录的接口，第 n 次查询时登录成功
+func passportStub(t *testing.T, codes []int) *httptest.Server {
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/x/passport-login/web/qrcode/generate", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"url":"https://passport.bilibili.com/h5-app/passport/login/scan?qrcode_key=key123","qrcode_key":"key123"}}`))
+	})
+	mux.HandleFunc("/x/passport-login/web/qrcode/poll", func(w http.ResponseWriter, r *http.Request) {
+		if key := r.URL.Query().Get("qrcode_key"); key != "key123" {
+			t.Errorf("qrcode_key got: %s, except: key123", key)
+		}
+		code := codes[polls]
+		polls++
+		var data string
+		if code == qrSuccess {
+			data = `{"url":"https://passport.biligame.com/crossDomain?DedeUserID=10086&DedeUserID__ckMd5=md5&Expires=1&SESSDATA=sess%2C123&bili_jct=csrf&gourl=https%3A%2F%2Fwww.bilibili.com","refresh_token":"token","timestamp":1,"code":0,"message":""}`
+		} else {
+			data = fmt.Sprintf(`{"url":"","refresh_token":"","timestamp":0,"code":%d,"message":""}`, code)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":0,"message":"0","data":` + data + `}`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestLoginByQR(t *testing.T) {
+	server := passportStub(t, []int{qrWaiting, qrConfirming, qrConfirming, qrSuccess})
+	defer server.Close()
+	old := passportURL
+	passportURL = server.URL
+	defer func() { passportURL = old }()
+
+	out := &bytes.Buffer{}
+	acc, err := loginByQR(out, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BotAccount{Account: Account{uid: 10086}, uidMd5: "md5", sessData: "sess,123", csrf: "csrf", refreshToken: "token"}
+	if acc != want {
+		t.Errorf("got: %+v, except: %+v", acc, want)
+	}
+	if !strings.Contains(out.String(), "█") || strings.Count(out.String(), "已扫码") != 1 {
+		t.Errorf("output: %s", out.String())
+	}
+}
+
+func TestLoginByQRExpired(t *testing.T) {
+	server := passportStub(t, []int{qrWaiting, qrExpired})
+	defer server.Close()
+	old := passportURL
+	passportURL = server.URL
+	defer func() { passportURL = old }()
+
+	if _, err := loginByQR(&bytes.Buffer{}, time.Millisecond); err != ErrQRExpired {
+		t.Errorf("got: %v, except: %v", err, ErrQRExpired)
+	}
+}
+
+func TestSaveAccount(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "setting.json")
+	setting := `{
+  "botAccount": {"uid": 1, "sid": "old-sid", "csrf": "old"},
+  "config": {"fresh": 2}
+}`
+	if err := os.WriteFile(file, []byte(setting), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	acc := BotAccount{Account: Account{uid: 10086}, uidMd5: "md5", sessData: "sess", csrf: "csrf", refreshToken: "token"}
+	if err := saveAccount(file, acc); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(file)
+	result := gjson.ParseBytes(data)
+	got := readBotAccount(result)
+	acc.sid = "old-sid"
+	if got != acc {
+		t.Errorf("got: %+v, except: %+v", got, acc)
+	}
+	if fresh := result.Get("config.fresh").Int(); fresh != 2 {
+		t.Errorf("other settings changed: %s", data)
+	}
+	if stat, _ := os.Stat(file); stat.Mode().Perm() != 0o644 {
+		t.Errorf("perm got: %v, except: %v", stat.Mode().Perm(), os.FileMode(0o644))
+	}
+	//临时文件已经删除
+	if files, _ := filepath.Glob(file + ".*"); len(files) != 0 {
+		t.Errorf("temp files: %v", files)
+	}
+}
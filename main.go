@@ -2,21 +2,23 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
 	"flag"
+	"github.com/Hami-Lemon/bobo-bot/analyse"
 	"github.com/Hami-Lemon/bobo-bot/logger"
 	"github.com/Hami-Lemon/bobo-bot/push"
+	"github.com/Hami-Lemon/bobo-bot/request"
 	"github.com/tidwall/gjson"
-	"io"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"time"
 )
 
 const (
 	Version     = "0.3.1"
 	logFileSize = 1024 * 512
+	settingFile = "setting.json" //设置文件
 )
 
 var (
@@ -25,7 +27,7 @@ var (
 	//logDst    logger.Appender = logger.NewFileAppender(logFileSize)
 	logDst      logger.Appender = logger.NewConsoleAppender()
 	mainLogger                  = logger.New("main", logLevel, logger.NewConsoleAppender())
-	db          *DB
+	db          Store
 	pusher      push.Pusher //消息推送
 	summaryFile = flag.String("r", "", "数据总结文件")
 )
@@ -33,69 +35,166 @@ var (
 type config struct {
 	BotOption
 	isFans bool
-	hour   int
-	minute int
-	dbname string
+	//是否监控账号发布的新动态
+	isDynamic bool
+	//是否监控账号的个人资料修改
+	isProfile bool
+	//发布新动态后是否监控新动态的评论区，为 followAdd 或者 followSwitch
+	followDynamic string
+	hour          int
+	minute        int
+	dbdriver      string //数据库类型，sqlite3 或者 postgres
+	dbname        string
+	admin         struct {
+		addr  string
+		token string
+	}
+	metricsAddr string
+	session     int                      //检查登录状态的间隔，单位：分钟
+	cookieFile  string                   //保存 cookie 的文件，为空时不保存
+	limits      map[string]request.Limit //每个请求路径的频率限制，键为空字符串时是默认限制
 }
 
 func main() {
 	flag.Parse()
+	//bobo-bot login 扫码登录
+	if flag.Arg(0) == "login" {
+		login()
+		return
+	}
+	//bobo-bot dedupe [dbname] 去除数据库中重复的评论
+	if flag.Arg(0) == "dedupe" {
+		if err := dedupe(flag.Arg(1)); err != nil {
+			mainLogger.Error("去除重复的评论失败，%v", err)
+		}
+		return
+	}
 	mainLogger.Info("bobo-bot version: %s build on %s", Version, buildTime)
-	botAccount, monitorAccount, board, con := readSetting()
-	bili := BiliBiliLogin(botAccount)
-	if bili == nil {
-		mainLogger.Error("登录失败！")
+	botAccount, monitorAccount, boards, con := readSetting()
+	if len(boards) == 0 {
+		mainLogger.Error("未指定评论区")
+		return
+	}
+	jar, botAccount := loadCookies(con.cookieFile, botAccount)
+	bili, err := BiliBiliLogin(botAccount, jar)
+	if err != nil {
+		mainLogger.Error("登录失败！%v", err)
 		return
 	} else {
-		mainLogger.Info("登录成功，%s", bili.user.uname)
+		mainLogger.Info("登录成功，%s", bili.User().uname)
 	}
-	db = NewDB(con.dbname)
+	for path, limit := range con.limits {
+		bili.client.SetLimit(path, limit)
+	}
+	db = OpenStore(con.dbdriver, con.dbname)
 	if db == nil {
 		return
 	}
-	var bot *Bot
-	if strings.Compare("", *summaryFile) == 0 {
-		bot = NewBot(bili, board, monitorAccount, con.BotOption)
-	} else {
+	var recovered *Bot
+	if strings.Compare("", *summaryFile) != 0 {
 		mainLogger.Info("从上次中断中恢复...")
-		f, err := os.Open(*summaryFile)
+		summary, err := analyse.Load(*summaryFile)
 		if err != nil {
-			mainLogger.Error("打开文件失败，%v", err)
+			mainLogger.Error("读取文件失败，%v", err)
 			return
 		}
-		var summary Summary
-		err = json.NewDecoder(f).Decode(&summary)
-		if err != nil {
-			mainLogger.Error("解析文件失败，%v", err)
-			return
+		recovered = RecoverBot(bili, con.BotOption, summary)
+		mainLogger.Info("恢复信息：start=%s", recovered.counter.startTime.Format("01-02 15:04:05"))
+		mainLogger.Info("board:%d, allCount=%d, count=%d", recovered.board.oid, recovered.board.allCount, recovered.board.count)
+		mainLogger.Info("account:%d, uname=%s, follower=%d", recovered.monitor.uid, recovered.monitor.uname, recovered.monitor.follower)
+	}
+	bots := make([]*Bot, 0, len(boards)+1)
+	for _, board := range boards {
+		//恢复的评论区替换掉设置中对应的评论区
+		if recovered != nil && recovered.board.dId == board.dId && recovered.board.bvID == board.bvID {
+			bots = append(bots, recovered)
+			recovered = nil
+			continue
+		}
+		bot := NewBot(bili, board, monitorAccount, con.BotOption)
+		//自动从该评论区最新的检查点恢复
+		if at, ok := bot.Resume(); ok {
+			mainLogger.Info("从检查点恢复：name=%s, start=%s, checkpoint=%s", bot.board.name,
+				bot.counter.startTime.Format("01-02 15:04:05"), at.Format("01-02 15:04:05"))
+			//程序停止期间错过了数据汇总，先汇总之前的数据
+			if missedSummary(at, time.Now(), con.hour, con.minute) {
+				if fileName := bot.Summarize(); strings.Compare("", fileName) != 0 {
+					bot.ReportSummarize(fileName)
+				}
+			}
 		}
-		bot = RecoverBot(bili, con.BotOption, summary)
-		mainLogger.Info("恢复信息：start=%s", bot.counter.startTime.Format("01-02 15:04:05"))
-		mainLogger.Info("board:%d, allCount=%d, count=%d", bot.board.oid, bot.board.allCount, bot.board.count)
-		mainLogger.Info("account:%d, uname=%s, follower=%d", bot.monitor.uid, bot.monitor.uname, bot.monitor.follower)
-	}
-	go waitExit(bot)
-	go summarize(bot, con.hour, con.minute)
-	go readCmd(bot)
+		bots = append(bots, bot)
+	}
+	//设置中没有恢复的评论区，额外监控该评论区
+	if recovered != nil {
+		bots = append(bots, recovered)
+	}
+	group := &BotGroup{}
+	for _, bot := range bots {
+		group.Start(bot)
+	}
+	stop := make(chan struct{})
+	exit := stopAll(group, stop)
+	go waitExit(exit)
+	go summarize(group, con.hour, con.minute)
+	go readCmd(exit)
 	mainLogger.Info("开始赛博监控...")
-	mainLogger.Info("监控评论区：name=%s, did=%d, bv=%s", board.name, board.dId, board.bvID)
 	defer logDst.Close()
+	session := NewSession(bili, time.Duration(con.session)*time.Minute, con.cookieFile)
+	go session.Run(stop)
 	if con.isFans {
 		mainLogger.Info("粉丝数监控：uid=%d", monitorAccount.uid)
-		go bot.MonitorFans()
+		go MonitorFans(bili, group, stop)
+	}
+	if con.isProfile {
+		mainLogger.Info("个人资料监控：uid=%d", monitorAccount.uid)
+		go MonitorProfile(bili, monitorAccount, stop)
+	}
+	if con.isDynamic {
+		mainLogger.Info("动态监控：uid=%d, follow=%s", monitorAccount.uid, con.followDynamic)
+		go MonitorDynamic(bili, group, monitorAccount, con.BotOption, con.followDynamic, stop)
+	}
+	if con.metricsAddr != "" {
+		server := StartMetrics(con.metricsAddr)
+		defer server.Close()
+	}
+	var admin *Admin
+	if con.admin.addr != "" {
+		if con.admin.token == "" {
+			mainLogger.Error("未设置管理接口的令牌，不启动管理接口")
+		} else {
+			admin = NewAdmin(con.admin.addr, con.admin.token, group, exit)
+			admin.Start()
+		}
 	}
-	bot.Monitor()
-	bot.Summarize()
+	group.Wait()
+	//所有 bot 生成数据汇总后再关闭，之后等待请求频率限制的请求直接返回
+	bili.client.Close()
+	if admin != nil {
+		admin.Stop()
+	}
+	session.SaveCookies()
 	db.Close()
 	mainLogger.Info("程序停止")
 }
 
-func readCmd(bot *Bot) {
+//停止所有的 bot，返回的函数可以重复调用
+func stopAll(group *BotGroup, stop chan struct{}) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			group.Stop(nil)
+		})
+	}
+}
+
+func readCmd(exit func()) {
 	sc := bufio.NewScanner(os.Stdin)
 	for sc.Scan() {
 		text := sc.Text()
 		if strings.Compare(text, "exit") == 0 || strings.Compare(text, "quit") == 0 {
-			bot.Stop()
+			exit()
 			return
 		} else {
 			mainLogger.Warn("error command!")
@@ -104,22 +203,24 @@ func readCmd(bot *Bot) {
 }
 
 //程序结束时停止并释放bot
-func waitExit(bot *Bot) {
+func waitExit(exit func()) {
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, os.Interrupt, os.Kill)
 	<-ch
 	mainLogger.Info("停止赛博监控")
-	bot.Stop()
+	exit()
 }
 
 //定时器，在指定时间汇总数据
-func summarize(bot *Bot, h, m int) {
+func summarize(group *BotGroup, h, m int) {
 	tick := time.Tick(time.Minute)
 	for t := range tick {
 		if (h == -1 || t.Hour() == h) && t.Minute() == m {
-			fileName := bot.Summarize()
-			if strings.Compare("", fileName) != 0 {
-				bot.ReportSummarize(fileName)
+			for _, bot := range group.All() {
+				fileName := bot.Summarize()
+				if strings.Compare("", fileName) != 0 {
+					bot.ReportSummarize(fileName)
+				}
 			}
 		}
 	}
@@ -136,50 +237,162 @@ func pushAndLog(l *logger.Logger, msg string, args ...any) {
 	}()
 }
 
+//读取设置文件 setting.json
+func loadSetting() (gjson.Result, error) {
+	data, err := os.ReadFile(settingFile)
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	return gjson.ParseBytes(data), nil
+}
+
+//读取登录账号所需要的cookie
+func readBotAccount(setting gjson.Result) BotAccount {
+	botAcc := BotAccount{}
+	botAcc.uid = setting.Get("botAccount.uid").Uint()                     //DedeUserID
+	botAcc.uidMd5 = setting.Get("botAccount.uidMd5").String()             //DedeUserID__ckMd5
+	botAcc.sessData = setting.Get("botAccount.sessData").String()         //SESSDATA
+	botAcc.csrf = setting.Get("botAccount.csrf").String()                 //bili_jct
+	botAcc.sid = setting.Get("botAccount.sid").String()                   //sid
+	botAcc.refreshToken = setting.Get("botAccount.refreshToken").String() //refresh_token，用于刷新 cookie
+	return botAcc
+}
+
+//读取请求头配置，所有请求都使用该配置中的请求头
+func readProfile(setting gjson.Result) error {
+	header, err := request.ProfileHeader(setting.Get("config.profile").String())
+	if err != nil {
+		return err
+	}
+	browserHeader = header
+	return nil
+}
+
+//读取请求频率限制，键为请求路径，在内置的限制的基础上使用设置中的 limit 覆盖，
+//limit 中的 default 为没有单独设置的路径共用的限制，likeCD 为两次点赞间隔的秒数
+func readLimits(setting gjson.Result, likeCD float64) map[string]request.Limit {
+	limits := make(map[string]request.Limit, len(defaultLimits))
+	for path, limit := range defaultLimits {
+		limits[path] = limit
+	}
+	//点赞的频率由 like 决定
+	if likeCD > 0 {
+		limits[likePath] = request.Limit{Rate: 1 / likeCD, Burst: 1}
+	}
+	setting.Get("limit").ForEach(func(key, value gjson.Result) bool {
+		path := key.String()
+		if path == "default" {
+			path = ""
+		}
+		limits[path] = request.Limit{
+			Rate:  value.Get("rate").Float(),
+			Burst: int(value.Get("burst").Int()),
+		}
+		return true
+	})
+	return limits
+}
+
 //读取设置信息，设置文件为 setting.json
-func readSetting() (BotAccount, MonitorAccount, Board, config) {
+func readSetting() (BotAccount, MonitorAccount, []Board, config) {
 	botAcc := BotAccount{}
 	acc := MonitorAccount{}
-	board := Board{}
+	var boards []Board
 	con := config{}
-	settingFile, err := os.Open("setting.json")
+	setting, err := loadSetting()
 	if err != nil {
 		mainLogger.Error("读取设置失败，%v", err)
 		panic(err)
 	}
-	defer settingFile.Close()
-	data, err := io.ReadAll(settingFile)
-	if err != nil {
-		mainLogger.Error("%v", err)
-		panic(err)
-	}
-	setting := gjson.ParseBytes(data)
-	//登录账号所需要的cookie
-	botAcc.uid = setting.Get("botAccount.uid").Uint()             //DedeUserID
-	botAcc.uidMd5 = setting.Get("botAccount.uidMd5").String()     //DedeUserID__ckMd5
-	botAcc.sessData = setting.Get("botAccount.sessData").String() //SESSDATA
-	botAcc.csrf = setting.Get("botAccount.csrf").String()         //bili_jct
-	botAcc.sid = setting.Get("botAccount.sid").String()           //sid
+	botAcc = readBotAccount(setting)
 
 	//监控的账号
 	acc.uid = setting.Get("account.uid").Uint()       //uid
 	acc.alias = setting.Get("account.alias").String() //别名
 
-	//评论区信息
-	board.name = setting.Get("board.name").String() //别名
-	//did, 例如：https://t.bilibili.com/662016827293958168 中的 662016827293958168 即是对应的did
-	board.dId = setting.Get("board.oid").Uint()
-	board.bvID = setting.Get("board.bv").String()
+	//评论区信息，boards 为需要监控的评论区列表，兼容只有一个 board 的旧设置
+	readBoard := func(item gjson.Result) Board {
+		return Board{
+			name: item.Get("name").String(), //别名
+			//did, 例如：https://t.bilibili.com/662016827293958168 中的 662016827293958168 即是对应的did
+			dId:  item.Get("oid").Uint(),
+			bvID: item.Get("bv").String(),
+		}
+	}
+	if items := setting.Get("boards"); items.IsArray() {
+		for _, item := range items.Array() {
+			boards = append(boards, readBoard(item))
+		}
+	} else if item := setting.Get("board"); item.Exists() {
+		boards = append(boards, readBoard(item))
+	}
 
 	//每隔 freshCD 秒获取一次评论，值太小可能会被b站 ban ip
 	con.freshCD = int(setting.Get("config.fresh").Int())
-	con.likeCD = float32(setting.Get("config.like").Float()) //点赞一次后等待的秒数
+	likeCD := setting.Get("config.like").Float() //两次点赞间隔的秒数
 	con.isLike = setting.Get("config.isLike").Bool()
 	con.isPost = setting.Get("config.isPost").Bool()
-	con.isFans = setting.Get("config.isFans").Bool()     //是否监控粉丝数变化
-	con.hour = int(setting.Get("config.hour").Int())     //生成数据汇总的小时数，为 -1 则每小时生成一次
-	con.minute = int(setting.Get("config.minute").Int()) //生成数据汇总的分钟数
-	con.dbname = setting.Get("config.dbname").String()   //sqlite3 数据库名称，一个文件名即可
+	//每次获取评论时最多翻的页数，一页为30条评论
+	con.maxPage = int(setting.Get("config.maxPage").Int())
+	if con.maxPage <= 0 {
+		con.maxPage = 5
+	}
+	con.isFans = setting.Get("config.isFans").Bool() //是否监控粉丝数变化
+	con.isDynamic = setting.Get("config.isDynamic").Bool()
+	con.isProfile = setting.Get("config.isProfile").Bool()
+	con.followDynamic = setting.Get("config.followDynamic").String()
+	switch con.followDynamic {
+	case followNone, followAdd, followSwitch:
+	default:
+		mainLogger.Error("followDynamic 的值错误：%s，可选的值：%s、%s", con.followDynamic, followAdd, followSwitch)
+		panic("invalid followDynamic")
+	}
+	//数据总结默认使用 go 绘制图表，设置为 python 时使用 analyse/main.py 脚本
+	con.python = setting.Get("config.render").String() == "python"
+	con.format = analyse.Format(setting.Get("config.imgFormat").String()) //图表格式：jpg, png, svg
+	if con.format == "" {
+		con.format = analyse.JPEG
+	}
+	con.hour = int(setting.Get("config.hour").Int())       //生成数据汇总的小时数，为 -1 则每小时生成一次
+	con.minute = int(setting.Get("config.minute").Int())   //生成数据汇总的分钟数
+	con.dbdriver = setting.Get("config.dbdriver").String() //数据库类型，为空时使用 sqlite3
+	con.dbname = setting.Get("config.dbname").String()     //sqlite3 数据库名称，一个文件名即可；postgres 则为连接字符串
+	//启动时补充获取程序停止期间的评论，最多翻的页数，为0则不补充获取
+	con.backfillPage = 10
+	if item := setting.Get("config.backfill"); item.Exists() {
+		con.backfillPage = int(item.Int())
+	}
+	con.backfillLike = setting.Get("config.backfillLike").Bool() //是否点赞补充获取到的评论
+	//每隔多少分钟保存一次统计数据的检查点，为0则不保存
+	con.checkpoint = 5
+	if item := setting.Get("config.checkpoint"); item.Exists() {
+		con.checkpoint = int(item.Int())
+	}
+	con.limits = readLimits(setting, likeCD)
+	//每隔多少分钟检查一次 bot 账号的登录状态，为0则不检查
+	con.session = 10
+	if item := setting.Get("config.session"); item.Exists() {
+		con.session = int(item.Int())
+	}
+	con.cookieFile = "cookie.json"
+	if item := setting.Get("config.cookieFile"); item.Exists() {
+		con.cookieFile = item.String()
+	}
+	//评论的处理规则，没有设置时使用默认规则
+	con.rules, err = parseRules(setting.Get("rules"))
+	if err != nil {
+		mainLogger.Error("读取评论处理规则失败，%v", err)
+		panic(err)
+	}
+	if err = readProfile(setting); err != nil {
+		mainLogger.Error("读取请求头配置失败，%v", err)
+		panic(err)
+	}
+	//管理接口监听的地址，为空则不启动，访问接口时需要携带令牌
+	con.admin.addr = setting.Get("admin.addr").String()
+	con.admin.token = setting.Get("admin.token").String()
+	//Prometheus 监控指标监听的地址，为空则不启动
+	con.metricsAddr = setting.Get("metrics.addr").String()
 
 	loggerLevel := setting.Get("logger.level").String()       //日志级别
 	loggerAppender := setting.Get("logger.appender").String() //日志写入文件还是直接在控制台输出
@@ -210,5 +423,5 @@ func readSetting() (BotAccount, MonitorAccount, Board, config) {
 	default:
 		break
 	}
-	return botAcc, acc, board, con
+	return botAcc, acc, boards, con
 }
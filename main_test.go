@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Hami-Lemon/bobo-bot/request"
+	"github.com/tidwall/gjson"
+)
+
+func TestReadLimits(t *testing.T) {
+	//没有设置 limit 时使用内置的限制，点赞的频率由 like 决定
+	limits := readLimits(gjson.Parse(`{}`), 2)
+	for path, want := range defaultLimits {
+		if got, ok := limits[path]; !ok || got != want {
+			t.Errorf("%q got: %+v, except: %+v", path, got, want)
+		}
+	}
+	if got, want := limits[likePath], (request.Limit{Rate: 0.5, Burst: 1}); got != want {
+		t.Errorf("like got: %+v, except: %+v", got, want)
+	}
+
+	setting := gjson.Parse(`{"limit": {
+		"default": {"rate": 1, "burst": 1},
+		"/x/v2/reply/main": {"rate": 0.5, "burst": 2},
+		"/x/v2/reply/action": {"rate": 3, "burst": 3}
+	}}`)
+	limits = readLimits(setting, 2)
+	want := make(map[string]request.Limit)
+	for path, limit := range defaultLimits {
+		want[path] = limit
+	}
+	want[""] = request.Limit{Rate: 1, Burst: 1}
+	want["/x/v2/reply/main"] = request.Limit{Rate: 0.5, Burst: 2}
+	want[likePath] = request.Limit{Rate: 3, Burst: 3}
+	if !reflect.DeepEqual(limits, want) {
+		t.Errorf("got: %+v, except: %+v", limits, want)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Hami-Lemon/bobo-bot/metrics"
+)
+
+//导出到 Prometheus 的监控指标，board 标签为评论区名称，endpoint 标签为请求地址的路径
+var (
+	fetchedComments = metrics.NewCounter("bobo_comments_fetched_total",
+		"每次获取评论时获取到的评论数", "board")
+	newComments = metrics.NewCounter("bobo_comments_new_total",
+		"获取到的新评论数", "board")
+	likeResult = metrics.NewCounter("bobo_likes_total",
+		"点赞评论的次数，result 为 ok 或 fail", "board", "result")
+	likeQueueLen = metrics.NewGauge("bobo_like_queue_length",
+		"点赞任务队列中等待的评论数", "board")
+	commentDelay = metrics.NewGauge("bobo_comment_max_delay_seconds",
+		"最近一次获取到的新评论的最大延迟", "board")
+	followers = metrics.NewGauge("bobo_followers",
+		"监控账号的粉丝数", "uid")
+	requestDuration = metrics.NewHistogram("bobo_request_duration_seconds",
+		"网络请求的耗时", nil, "endpoint")
+	requestStatus = metrics.NewCounter("bobo_requests_total",
+		"网络请求的次数，status 为响应状态码，请求失败时为0", "endpoint", "status")
+	apiErrors = metrics.NewCounter("bobo_api_errors_total",
+		"接口返回的 code 不为0的次数", "endpoint", "code")
+)
+
+//记录网络请求的耗时和状态码
+func observeRequest(path string, status int, elapsed time.Duration) {
+	requestDuration.Observe(elapsed.Seconds(), path)
+	requestStatus.Inc(path, strconv.Itoa(status))
+}
+
+// StartMetrics 在 addr 上监听 /metrics
+func StartMetrics(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		mainLogger.Info("监控指标监听：%s", addr)
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			mainLogger.Error("监控指标启动失败，%v", err)
+		}
+	}()
+	return server
+}
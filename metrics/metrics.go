@@ -0,0 +1,258 @@
+// Package metrics
+//以 Prometheus 文本格式导出监控指标，只实现了用到的 counter, gauge 和 histogram
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//collector 可以被 Registry 导出的指标
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry 指标的集合
+type Registry struct {
+	collectors []collector
+	lock       sync.Mutex
+}
+
+// Default 默认的指标集合
+var Default = &Registry{}
+
+func (r *Registry) register(c collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Export 按注册顺序将所有的指标以文本格式写入 w
+func (r *Registry) Export(w io.Writer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, c := range r.collectors {
+		c.write(w)
+	}
+}
+
+// ServeHTTP 实现 http.Handler，用于 Prometheus 抓取
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Export(w)
+}
+
+//指标的名称、说明和标签名
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d *desc) header(w io.Writer, typ string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, typ)
+}
+
+//将标签值拼接为 map 的键
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s 需要 %d 个标签，实际为 %d 个", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+//生成 {a="1",b="2"} 形式的标签，extra 为额外的标签，例如 histogram 的 le
+func (d *desc) format(key string, extra ...string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		values := strings.Split(key, "\xff")
+		for i, name := range d.labels {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", name, strconv.Quote(values[i])))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", extra[i], strconv.Quote(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+//按键排序，保证每次导出的顺序一致
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//counter 和 gauge 的共同实现
+type value struct {
+	desc
+	typ    string
+	values map[string]float64
+	lock   sync.Mutex
+}
+
+func (v *value) add(delta float64, labels []string) {
+	key := v.key(labels)
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.values[key] += delta
+}
+
+func (v *value) write(w io.Writer) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.header(w, v.typ)
+	for _, key := range sortedKeys(v.values) {
+		_, _ = fmt.Fprintf(w, "%s%s %s\n", v.name, v.format(key), formatFloat(v.values[key]))
+	}
+}
+
+// Counter 只增不减的计数器
+type Counter struct {
+	value
+}
+
+// NewCounter 创建计数器并注册到 Default 中，labels 为标签名
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{value{
+		desc:   desc{name: name, help: help, labels: labels},
+		typ:    "counter",
+		values: make(map[string]float64),
+	}}
+	Default.register(c)
+	return c
+}
+
+// Inc 计数加一，labels 为标签值，数量和顺序需要与创建时的标签名一致
+func (c *Counter) Inc(labels ...string) {
+	c.add(1, labels)
+}
+
+// Add 计数增加 delta，delta 不能为负数
+func (c *Counter) Add(delta float64, labels ...string) {
+	if delta < 0 {
+		return
+	}
+	c.add(delta, labels)
+}
+
+// Gauge 可以任意设置的值
+type Gauge struct {
+	value
+}
+
+// NewGauge 创建 Gauge 并注册到 Default 中，labels 为标签名
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{value{
+		desc:   desc{name: name, help: help, labels: labels},
+		typ:    "gauge",
+		values: make(map[string]float64),
+	}}
+	Default.register(g)
+	return g
+}
+
+// Set 设置值
+func (g *Gauge) Set(v float64, labels ...string) {
+	key := g.key(labels)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.values[key] = v
+}
+
+// Add 增加 delta，可以为负数
+func (g *Gauge) Add(delta float64, labels ...string) {
+	g.add(delta, labels)
+}
+
+//单个标签组合下的直方图数据
+type histogramData struct {
+	counts []uint64 //每个区间的数量，不是累计值
+	sum    float64
+	count  uint64
+}
+
+// Histogram 直方图，用于统计耗时等分布
+type Histogram struct {
+	desc
+	buckets []float64 //区间的上界，升序
+	data    map[string]*histogramData
+	lock    sync.Mutex
+}
+
+// DefBuckets 默认的区间，适用于以秒为单位的网络请求耗时
+var DefBuckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// NewHistogram 创建直方图并注册到 Default 中，buckets 为区间上界，为 nil 时使用 DefBuckets
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	sorted := make([]float64, len(buckets))
+	copy(sorted, buckets)
+	sort.Float64s(sorted)
+	h := &Histogram{
+		desc:    desc{name: name, help: help, labels: labels},
+		buckets: sorted,
+		data:    make(map[string]*histogramData),
+	}
+	Default.register(h)
+	return h
+}
+
+// Observe 记录一个值
+func (h *Histogram) Observe(v float64, labels ...string) {
+	key := h.key(labels)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	d, ok := h.data[key]
+	if !ok {
+		d = &histogramData{counts: make([]uint64, len(h.buckets))}
+		h.data[key] = d
+	}
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		d.counts[i]++
+	}
+	d.sum += v
+	d.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.header(w, "histogram")
+	for _, key := range sortedKeys(h.data) {
+		d := h.data[key]
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += d.counts[i]
+			_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.format(key, "le", formatFloat(le)), cumulative)
+		}
+		_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.format(key, "le", "+Inf"), d.count)
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.format(key), formatFloat(d.sum))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.format(key), d.count)
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	old := Default
+	Default = &Registry{}
+	defer func() { Default = old }()
+
+	c := NewCounter("test_total", "test counter", "board", "result")
+	c.Inc("a", "ok")
+	c.Inc("a", "ok")
+	c.Add(3, "b", "fail")
+	g := NewGauge("test_gauge", "test gauge")
+	g.Set(1.5)
+	h := NewHistogram("test_seconds", "test histogram", []float64{1, 0.1}, "path")
+	h.Observe(0.05, "/x")
+	h.Observe(0.5, "/x")
+	h.Observe(2, "/x")
+
+	buf := &bytes.Buffer{}
+	Default.Export(buf)
+	want := strings.Join([]string{
+		"# HELP test_total test counter",
+		"# TYPE test_total counter",
+		`test_total{board="a",result="ok"} 2`,
+		`test_total{board="b",result="fail"} 3`,
+		"# HELP test_gauge test gauge",
+		"# TYPE test_gauge gauge",
+		"test_gauge 1.5",
+		"# HELP test_seconds test histogram",
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{path="/x",le="0.1"} 1`,
+		`test_seconds_bucket{path="/x",le="1"} 2`,
+		`test_seconds_bucket{path="/x",le="+Inf"} 3`,
+		`test_seconds_sum{path="/x"} 2.55`,
+		`test_seconds_count{path="/x"} 3`,
+	}, "\n") + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nexcept:\n%s", got, want)
+	}
+}
+
+func TestLabelEscape(t *testing.T) {
+	d := desc{name: "x", labels: []string{"msg"}}
+	if got, want := d.format(d.key([]string{`a"b\c`})), `{msg="a\"b\\c"}`; got != want {
+		t.Errorf("got: %s, except: %s", got, want)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"time"
+)
+
+//需要监控的个人资料字段，按照推送时的顺序排列
+var profileFields = []struct {
+	name  string //保存到数据库中的字段名
+	label string //推送时显示的名称
+}{
+	{"uname", "昵称"},
+	{"face", "头像"},
+	{"sign", "签名"},
+	{"live", "直播间"},
+	{"top", "置顶动态"},
+}
+
+//个人资料的一次修改
+type profileChange struct {
+	field   string
+	label   string
+	old     string
+	new     string
+	initial bool //第一次记录该字段，没有之前的值
+}
+
+//获取账号当前的个人资料，键为字段名，获取失败的字段不包含在内
+func profileSnapshot(bili *BiliBili, account MonitorAccount) map[string]string {
+	snapshot := make(map[string]string)
+	if err := bili.AccountInfo(&account); err != nil {
+		mainLogger.Error("获取用户信息失败！uid=%d, %v", account.uid, err)
+	} else {
+		snapshot["uname"] = account.uname
+		snapshot["face"] = account.face
+		snapshot["sign"] = account.sign
+		snapshot["live"] = "未开播"
+		if account.live {
+			snapshot["live"] = "直播中：" + account.liveTitle
+		}
+	}
+	dynamics, _, err := bili.AccountSpace(account, "")
+	if err != nil {
+		mainLogger.Error("获取动态失败，uid=%d, %v", account.uid, err)
+		return snapshot
+	}
+	snapshot["top"] = ""
+	for _, dynamic := range dynamics {
+		if dynamic.top {
+			snapshot["top"] = "https://t.bilibili.com/" + dynamic.id
+			break
+		}
+	}
+	return snapshot
+}
+
+//比较上一次记录的个人资料 last 和当前的个人资料 now，返回发生变化的字段
+func diffProfile(last, now map[string]string) []profileChange {
+	var changes []profileChange
+	for _, f := range profileFields {
+		value, ok := now[f.name]
+		if !ok {
+			continue
+		}
+		old, exist := last[f.name]
+		if exist && old == value {
+			continue
+		}
+		changes = append(changes, profileChange{
+			field:   f.name,
+			label:   f.label,
+			old:     old,
+			new:     value,
+			initial: !exist,
+		})
+	}
+	return changes
+}
+
+// MonitorProfile 每隔10分钟检查一次账号的个人资料，包括昵称、头像、签名、直播间状态和置顶动态，
+//与数据库中记录的上一次的值比较，发生变化时保存到 profile_history 表中并推送提醒
+func MonitorProfile(bili *BiliBili, account MonitorAccount, stop <-chan struct{}) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	last := db.LastProfile(account.uid)
+	check := func(now time.Time) {
+		snapshot := profileSnapshot(bili, account)
+		if uname, ok := snapshot["uname"]; ok && account.alias == "" {
+			account.alias = uname
+		}
+		for _, change := range diffProfile(last, snapshot) {
+			db.InsertProfileChange(account.uid, change, now.Unix())
+			last[change.field] = change.new
+			if change.initial {
+				continue
+			}
+			mainLogger.Info("个人资料修改，uid=%d, %s: %s -> %s", account.uid, change.label, change.old, change.new)
+			pushAndLog(mainLogger, "[%s]\n%s修改了%s：\n%s\n->\n%s", now.Format("01-02 15:04:05"),
+				account.alias, change.label, change.old, change.new)
+		}
+	}
+	check(time.Now())
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			check(now)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffProfile(t *testing.T) {
+	last := map[string]string{"uname": "a", "face": "face1", "sign": "sign", "live": "未开播"}
+	now := map[string]string{"uname": "b", "face": "face1", "sign": "sign", "live": "直播中：title", "top": ""}
+	want := []profileChange{
+		{field: "uname", label: "昵称", old: "a", new: "b"},
+		{field: "live", label: "直播间", old: "未开播", new: "直播中：title"},
+		{field: "top", label: "置顶动态", new: "", initial: true},
+	}
+	if got := diffProfile(last, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v, except: %+v", got, want)
+	}
+	//获取失败的字段不比较
+	if got := diffProfile(last, map[string]string{}); len(got) != 0 {
+		t.Errorf("got: %+v, except: []", got)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/Hami-Lemon/bobo-bot/request"
+)
+
+//主站地址，获取 refresh_csrf 时使用，测试时替换为本地的服务
+var mainURL = "https://www.bilibili.com"
+
+//生成 correspondPath 使用的公钥，参考自：https://github.com/SocialSisterYi/bilibili-API-collect/blob/master/docs/login/cookie_refresh.md
+const correspondKey = `-----BEGIN PUBLIC KEY-----
+MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDLgd2OAkcGVtoE3ThUREbio0Eg
+Uc/prcajMKXvkCKFCWhJYJcLkcM2DKKcSeFpD/j6Boy538YXnR6VhcuUJOhH2x71
+nzPjfdTcqMz7djHum0qSZA0AyCBDABUqCrfNgCiJ00Ra7GmRj+YCK1NJEuewlb40
+JNrRuoEUXpabUzGB8QIDAQAB
+-----END PUBLIC KEY-----`
+
+var (
+	// ErrNoRefreshToken 没有 refresh_token，不能刷新 cookie
+	ErrNoRefreshToken = errors.New("没有 refresh_token")
+	refreshCsrfRe     = regexp.MustCompile(`<div id="1-name">(.+?)</div>`)
+)
+
+// RefreshCookie 检查 cookie 是否需要刷新，需要时刷新 cookie，
+//并将新的 cookie 写入设置文件和当前登录的账号中，返回是否进行了刷新
+func (b *BiliBili) RefreshCookie() (bool, error) {
+	user := b.User()
+	if user.refreshToken == "" {
+		return false, ErrNoRefreshToken
+	}
+	//检查是否需要刷新
+	urlStr := passportURL + "/x/passport-login/web/cookie/info"
+	data, err := checkResp(b.client.Get(urlStr, map[string]interface{}{"csrf": user.csrf}, nil))
+	if err != nil {
+		return false, b.check(err)
+	}
+	if !data.Get("refresh").Bool() {
+		return false, nil
+	}
+	refreshCsrf, err := b.refreshCsrf(data.Get("timestamp").Int())
+	if err != nil {
+		return false, err
+	}
+	//刷新 cookie，新的 cookie 通过响应头设置
+	urlStr = passportURL + "/x/passport-login/web/cookie/refresh"
+	body := request.NewNameValeEntity(map[string]interface{}{
+		"csrf":          user.csrf,
+		"refresh_csrf":  refreshCsrf,
+		"source":        "main_web",
+		"refresh_token": user.refreshToken,
+	}, request.ApplicationUrlencoded)
+	data, err = checkResp(b.client.Post(urlStr, nil, body))
+	if err != nil {
+		return false, fmt.Errorf("刷新 cookie 失败：%w", err)
+	}
+	next, err := accountFromCookie(b.client.Cookie())
+	if err != nil {
+		return false, err
+	}
+	next.refreshToken = data.Get("refresh_token").String()
+	next.Account = Account{uid: next.uid, uname: user.uname, alias: user.alias}
+	//确认刷新，使旧的 refresh_token 失效，csrf 使用新的 cookie 中的值
+	urlStr = passportURL + "/x/passport-login/web/confirm/refresh"
+	body = request.NewNameValeEntity(map[string]interface{}{
+		"csrf":          next.csrf,
+		"refresh_token": user.refreshToken,
+	}, request.ApplicationUrlencoded)
+	if _, err = checkResp(b.client.Post(urlStr, nil, body)); err != nil {
+		//新的 cookie 已经生效，仍然需要保存
+		b.logger.Warn("确认刷新 cookie 失败：%v", err)
+	}
+	b.SetAccount(next)
+	if err = saveAccount(settingFile, next); err != nil {
+		return true, fmt.Errorf("写入设置失败：%w", err)
+	}
+	return true, nil
+}
+
+//获取刷新 cookie 时使用的 refresh_csrf，timestamp 为检查是否需要刷新时返回的时间戳，单位：毫秒
+func (b *BiliBili) refreshCsrf(timestamp int64) (string, error) {
+	path, err := correspondPath(timestamp)
+	if err != nil {
+		return "", err
+	}
+	entity, err := b.client.Get(mainURL+"/correspond/1/"+path, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("获取 refresh_csrf 失败：%w", statusError(err))
+	}
+	page, err := io.ReadAll(entity.Reader())
+	if err != nil {
+		return "", err
+	}
+	match := refreshCsrfRe.FindSubmatch(page)
+	if match == nil {
+		return "", errors.New("获取 refresh_csrf 失败：页面中没有 refresh_csrf")
+	}
+	return string(bytes.TrimSpace(match[1])), nil
+}
+
+//使用公钥加密 refresh_{timestamp}，生成获取 refresh_csrf 的路径
+func correspondPath(timestamp int64) (string, error) {
+	block, _ := pem.Decode([]byte(correspondKey))
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	msg := []byte("refresh_" + strconv.FormatInt(timestamp, 10))
+	cipher, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key.(*rsa.PublicKey), msg, nil)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(cipher), nil
+}
+
+//从 cookie 中读取登录账号
+func accountFromCookie(cookie map[string]string) (BotAccount, error) {
+	acc := BotAccount{
+		uidMd5:   cookie[DedeUserIDMd5],
+		sessData: cookie[SessData],
+		csrf:     cookie[Csrf],
+		sid:      cookie[SId],
+	}
+	var err error
+	acc.uid, err = strconv.ParseUint(cookie[DedeUserID], 10, 64)
+	if err != nil || acc.sessData == "" || acc.csrf == "" {
+		return BotAccount{}, errors.New("刷新 cookie 后无法获取新的 cookie")
+	}
+	return acc, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Hami-Lemon/bobo-bot/logger"
+	"github.com/Hami-Lemon/bobo-bot/request"
+	"github.com/tidwall/gjson"
+)
+
+//模拟刷新 cookie 的接口
+func refreshStub(t *testing.T, refresh bool) *httptest.Server {
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, data string) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":0,"message":"0","data":` + data + `}`))
+	}
+	mux.HandleFunc("/x/passport-login/web/cookie/info", func(w http.ResponseWriter, r *http.Request) {
+		if refresh {
+			writeJSON(w, `{"refresh":true,"timestamp":1684466082000}`)
+		} else {
+			writeJSON(w, `{"refresh":false,"timestamp":1684466082000}`)
+		}
+	})
+	mux.HandleFunc("/correspond/1/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html><body><div id="1-name">refresh-csrf</div></body></html>`))
+	})
+	mux.HandleFunc("/x/passport-login/web/cookie/refresh", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("refresh_csrf") != "refresh-csrf" || r.PostForm.Get("refresh_token") != "old-token" {
+			t.Errorf("refresh form: %v", r.PostForm)
+		}
+		http.SetCookie(w, &http.Cookie{Name: SessData, Value: "new-sess"})
+		http.SetCookie(w, &http.Cookie{Name: Csrf, Value: "new-csrf"})
+		writeJSON(w, `{"status":0,"message":"","refresh_token":"new-token"}`)
+	})
+	mux.HandleFunc("/x/passport-login/web/confirm/refresh", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("csrf") != "new-csrf" || r.PostForm.Get("refresh_token") != "old-token" {
+			t.Errorf("confirm form: %v", r.PostForm)
+		}
+		writeJSON(w, `null`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func testBili(user BotAccount) *BiliBili {
+	cookie := map[string]string{
+		DedeUserID:    "10086",
+		DedeUserIDMd5: user.uidMd5,
+		SessData:      user.sessData,
+		Csrf:          user.csrf,
+	}
+	return &BiliBili{
+		user:    user,
+		client:  request.New(browserHeader, cookie, 3),
+		logger:  logger.New("BiliBili", logLevel, logDst),
+		login:   1,
+		expired: make(chan struct{}, 1),
+	}
+}
+
+func TestRefreshCookie(t *testing.T) {
+	server := refreshStub(t, true)
+	defer server.Close()
+	oldPassport, oldMain := passportURL, mainURL
+	passportURL, mainURL = server.URL, server.URL
+	defer func() { passportURL, mainURL = oldPassport, oldMain }()
+	//新的 cookie 会写入当前目录下的设置文件
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	user := BotAccount{Account: Account{uid: 10086, uname: "bot", alias: "bot"},
+		uidMd5: "md5", sessData: "old-sess", csrf: "old-csrf", refreshToken: "old-token"}
+	bili := testBili(user)
+	ok, err := bili.RefreshCookie()
+	if err != nil || !ok {
+		t.Fatalf("got: %v %v, except: true <nil>", ok, err)
+	}
+	want := BotAccount{Account: Account{uid: 10086, uname: "bot", alias: "bot"},
+		uidMd5: "md5", sessData: "new-sess", csrf: "new-csrf", refreshToken: "new-token"}
+	if got := bili.User(); got != want {
+		t.Errorf("got: %+v, except: %+v", got, want)
+	}
+	data, err := os.ReadFile(settingFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gjson.GetBytes(data, "botAccount.refreshToken").String(); got != "new-token" {
+		t.Errorf("saved refreshToken got: %s, except: new-token", got)
+	}
+}
+
+func TestRefreshCookieNotNeeded(t *testing.T) {
+	server := refreshStub(t, false)
+	defer server.Close()
+	old := passportURL
+	passportURL = server.URL
+	defer func() { passportURL = old }()
+
+	bili := testBili(BotAccount{Account: Account{uid: 10086}, sessData: "sess", csrf: "csrf", refreshToken: "token"})
+	if ok, err := bili.RefreshCookie(); ok || err != nil {
+		t.Errorf("got: %v %v, except: false <nil>", ok, err)
+	}
+	bili = testBili(BotAccount{Account: Account{uid: 10086}, sessData: "sess", csrf: "csrf"})
+	if _, err := bili.RefreshCookie(); err != ErrNoRefreshToken {
+		t.Errorf("got: %v, except: %v", err, ErrNoRefreshToken)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
+	"net/textproto"
 	"net/url"
 )
 
@@ -18,6 +20,8 @@ type Entity interface {
 type ByteEntity struct {
 	contentType *ContentType //数据类型
 	reader      io.Reader    //读取数据的 reader
+	path        string       //作为响应体时，对应请求地址的路径
+	status      int          //作为响应体时，对应的响应状态码
 }
 
 func NewByteEntity(data []byte, contentType string) *ByteEntity {
@@ -39,6 +43,24 @@ func (b *ByteEntity) Reader() io.Reader {
 	return b.reader
 }
 
+// Path 作为响应体时，返回对应请求地址的路径，不含参数
+func (b *ByteEntity) Path() string {
+	return b.path
+}
+
+// Status 作为响应体时，返回对应的响应状态码
+func (b *ByteEntity) Status() int {
+	return b.status
+}
+
+//作为响应体时，返回响应体的数据，不会消耗 reader 中的数据
+func (b *ByteEntity) peek() []byte {
+	if buf, ok := b.reader.(*bytes.Buffer); ok {
+		return buf.Bytes()
+	}
+	return nil
+}
+
 // NameValueEntity 键值对的数据体
 type NameValueEntity struct {
 	items       map[string]interface{}
@@ -82,3 +104,49 @@ func (n *NameValueEntity) Reader() io.Reader {
 func (n *NameValueEntity) Add(name string, value interface{}) {
 	n.items[name] = value
 }
+
+// MultipartEntity multipart/form-data 格式的数据体，用于上传文件
+type MultipartEntity struct {
+	buf    *bytes.Buffer
+	writer *multipart.Writer
+	closed bool
+}
+
+func NewMultipartEntity() *MultipartEntity {
+	buf := &bytes.Buffer{}
+	return &MultipartEntity{
+		buf:    buf,
+		writer: multipart.NewWriter(buf),
+	}
+}
+
+// AddField 添加一个普通字段
+func (m *MultipartEntity) AddField(name string, value interface{}) error {
+	return m.writer.WriteField(name, fmt.Sprintf("%v", value))
+}
+
+// AddFile 添加一个文件，fileName 为文件名，contentType 为文件的数据类型，文件内容从 r 中读取
+func (m *MultipartEntity) AddFile(name, fileName, contentType string, r io.Reader) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, name, fileName))
+	h.Set("Content-Type", contentType)
+	part, err := m.writer.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, r)
+	return err
+}
+
+func (m *MultipartEntity) ContentType() string {
+	return m.writer.FormDataContentType()
+}
+
+// Reader 获取数据，调用后不能再添加字段
+func (m *MultipartEntity) Reader() io.Reader {
+	if !m.closed {
+		m.closed = true
+		_ = m.writer.Close()
+	}
+	return bytes.NewReader(m.buf.Bytes())
+}
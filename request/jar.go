@@ -0,0 +1,292 @@
+package request
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cookie Jar 中保存的 cookie
+type Cookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`   //为空时发送给所有域名
+	Path     string    `json:"path"`     //为空时发送给所有路径
+	HostOnly bool      `json:"hostOnly"` //为 true 时只发送给 Domain 本身，不包括子域名
+	Secure   bool      `json:"secure"`   //为 true 时只在 https 请求中发送
+	HttpOnly bool      `json:"httpOnly"`
+	Expires  time.Time `json:"expires"` //为零值时不会过期
+}
+
+//cookie 是否已经过期
+func (c *Cookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+//cookie 是否发送给所有域名，使用 Jar.Set 设置的 cookie 都是这种
+func (c *Cookie) global() bool {
+	return c.Domain == ""
+}
+
+//请求 host 和 path 时是否发送该 cookie
+func (c *Cookie) match(host, path string, https bool) bool {
+	if c.Secure && !https {
+		return false
+	}
+	if !c.global() {
+		if c.HostOnly && host != c.Domain {
+			return false
+		}
+		if !c.HostOnly && !domainMatch(host, c.Domain) {
+			return false
+		}
+	}
+	return pathMatch(path, c.Path)
+}
+
+//同一个域名和路径下的同名 cookie 只保留一个
+func (c *Cookie) id() string {
+	return c.Domain + ";" + c.Path + ";" + c.Name
+}
+
+// Jar 按照域名和路径保存 cookie，实现了 http.CookieJar，可以序列化为 JSON 保存到文件中。
+//
+//使用 Set 设置的 cookie 会发送给所有域名，用于手动设置的登录 cookie；响应中设置的 cookie 按照域名和路径发送。
+//两者同名时，后设置的覆盖先设置的，即 Set 会删除响应中设置的同名 cookie，响应中设置 cookie 时也会删除 Set 设置的同名 cookie
+type Jar struct {
+	lock    sync.RWMutex
+	cookies map[string]Cookie
+	version uint64 //每次修改后加一，用于判断是否需要保存
+}
+
+// NewJar 创建一个空的 Jar
+func NewJar() *Jar {
+	return &Jar{cookies: make(map[string]Cookie)}
+}
+
+// Set 设置发送给所有域名的 cookie，同名的 cookie 会被删除
+func (j *Jar) Set(name, value string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.put(Cookie{Name: name, Value: value})
+}
+
+// SetDomain 设置发送给 domain 及其子域名所有路径的 cookie，与响应中设置的同域名同路径的 cookie 相互覆盖
+func (j *Jar) SetDomain(domain, name, value string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.put(Cookie{Name: name, Value: value, Domain: strings.ToLower(strings.TrimPrefix(domain, ".")), Path: "/"})
+}
+
+//保存 cookie，需要持有写锁
+func (j *Jar) put(c Cookie) {
+	for id, old := range j.cookies {
+		//全局的 cookie 和按域名保存的 cookie 不能同名
+		if old.Name == c.Name && old.global() != c.global() {
+			delete(j.cookies, id)
+		}
+	}
+	j.cookies[c.id()] = c
+	j.version++
+}
+
+//删除 cookie，需要持有写锁
+func (j *Jar) remove(c Cookie) {
+	if _, ok := j.cookies[c.id()]; ok {
+		delete(j.cookies, c.id())
+		j.version++
+	}
+}
+
+// SetCookies 保存响应中设置的 cookie，实现 http.CookieJar
+//没有设置 Domain 的 cookie 只发送给 u 的域名，设置的 Domain 与 u 不匹配时忽略该 cookie，
+//MaxAge 小于0或者 Expires 已经过去时删除该 cookie
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := canonicalHost(u.Host)
+	now := time.Now()
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, hc := range cookies {
+		c := Cookie{
+			Name:     hc.Name,
+			Value:    hc.Value,
+			Path:     hc.Path,
+			Secure:   hc.Secure,
+			HttpOnly: hc.HttpOnly,
+		}
+		if hc.Domain == "" {
+			c.Domain, c.HostOnly = host, true
+		} else {
+			c.Domain = strings.ToLower(strings.TrimPrefix(hc.Domain, "."))
+			if !allowDomain(host, c.Domain) {
+				continue
+			}
+		}
+		if !strings.HasPrefix(c.Path, "/") {
+			c.Path = defaultPath(u.Path)
+		}
+		switch {
+		case hc.MaxAge < 0:
+			j.remove(c)
+			continue
+		case hc.MaxAge > 0:
+			c.Expires = now.Add(time.Duration(hc.MaxAge) * time.Second)
+		case !hc.Expires.IsZero():
+			c.Expires = hc.Expires
+		}
+		if c.expired(now) {
+			j.remove(c)
+			continue
+		}
+		j.put(c)
+	}
+}
+
+// Cookies 请求 u 时需要发送的 cookie，实现 http.CookieJar，路径更长的 cookie 排在前面
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	host := canonicalHost(u.Host)
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	https := u.Scheme == "https"
+	now := time.Now()
+	j.lock.RLock()
+	matched := make([]Cookie, 0, len(j.cookies))
+	for _, c := range j.cookies {
+		if !c.expired(now) && c.match(host, path, https) {
+			matched = append(matched, c)
+		}
+	}
+	j.lock.RUnlock()
+	sort.Slice(matched, func(a, b int) bool {
+		if len(matched[a].Path) != len(matched[b].Path) {
+			return len(matched[a].Path) > len(matched[b].Path)
+		}
+		return matched[a].Name < matched[b].Name
+	})
+	cookies := make([]*http.Cookie, len(matched))
+	for i, c := range matched {
+		cookies[i] = &http.Cookie{Name: c.Name, Value: c.Value}
+	}
+	return cookies
+}
+
+// All 所有未过期的 cookie 的快照，按照域名、路径和名称排序，对其进行修改不会影响 Jar
+func (j *Jar) All() []Cookie {
+	now := time.Now()
+	j.lock.RLock()
+	all := make([]Cookie, 0, len(j.cookies))
+	for _, c := range j.cookies {
+		if !c.expired(now) {
+			all = append(all, c)
+		}
+	}
+	j.lock.RUnlock()
+	sort.Slice(all, func(a, b int) bool {
+		return all[a].id() < all[b].id()
+	})
+	return all
+}
+
+// Values 所有未过期的 cookie 的名称和值，同名的 cookie 优先使用全局的，其次是域名和路径更长的
+func (j *Jar) Values() map[string]string {
+	all := j.All()
+	//排在后面的覆盖前面的
+	sort.SliceStable(all, func(a, b int) bool {
+		x, y := all[a], all[b]
+		if x.global() != y.global() {
+			return y.global()
+		}
+		if len(x.Domain) != len(y.Domain) {
+			return len(x.Domain) < len(y.Domain)
+		}
+		return len(x.Path) < len(y.Path)
+	})
+	values := make(map[string]string, len(all))
+	for _, c := range all {
+		values[c.Name] = c.Value
+	}
+	return values
+}
+
+// Version 修改的次数，与上一次保存时不同则说明需要重新保存
+func (j *Jar) Version() uint64 {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	return j.version
+}
+
+// MarshalJSON 将所有未过期的 cookie 序列化为 JSON 数组
+func (j *Jar) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.All())
+}
+
+// UnmarshalJSON 读取 MarshalJSON 输出的 cookie，与现有的 cookie 合并，同名的 cookie 使用读取的值
+func (j *Jar) UnmarshalJSON(data []byte) error {
+	var cookies []Cookie
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return err
+	}
+	now := time.Now()
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.cookies == nil {
+		j.cookies = make(map[string]Cookie)
+	}
+	for _, c := range cookies {
+		if !c.expired(now) {
+			j.put(c)
+		}
+	}
+	return nil
+}
+
+//去掉端口号并转换为小写
+func canonicalHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+//host 是否为 domain 或者 domain 的子域名
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return net.ParseIP(host) == nil && strings.HasSuffix(host, "."+domain)
+}
+
+//响应中的 cookie 是否可以设置为 domain，不允许设置顶级域名和其它域名的 cookie
+func allowDomain(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return strings.Contains(domain, ".") && domainMatch(host, domain)
+}
+
+//请求路径 path 是否需要发送路径为 cookiePath 的 cookie
+func pathMatch(path, cookiePath string) bool {
+	if cookiePath == "" || path == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(path, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || path[len(cookiePath)] == '/'
+}
+
+//响应中的 cookie 没有设置 Path 时使用的默认路径，即请求路径中最后一个 / 之前的部分
+func defaultPath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
@@ -0,0 +1,149 @@
+package request
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func cookieNames(cookies []*http.Cookie) []string {
+	names := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		names = append(names, c.Name+"="+c.Value)
+	}
+	return names
+}
+
+func TestJarScope(t *testing.T) {
+	jar := NewJar()
+	origin, _ := url.Parse("https://passport.bilibili.com/x/passport-login/web/cookie/refresh")
+	jar.SetCookies(origin, []*http.Cookie{
+		{Name: "domain", Value: "1", Domain: ".bilibili.com", Path: "/"},
+		{Name: "host", Value: "2", Path: "/"},
+		{Name: "path", Value: "3", Domain: "bilibili.com", Path: "/x/space"},
+		{Name: "secure", Value: "4", Domain: "bilibili.com", Path: "/", Secure: true},
+		{Name: "other", Value: "5", Domain: "example.com"},
+		{Name: "tld", Value: "6", Domain: "com"},
+	})
+	jar.Set("global", "7")
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"https://api.bilibili.com/x/space/acc/info", []string{"path=3", "domain=1", "secure=4", "global=7"}},
+		{"http://api.bilibili.com/x/spacex", []string{"domain=1", "global=7"}},
+		{"https://passport.bilibili.com/x/passport-login/web/qrcode", []string{"domain=1", "host=2", "secure=4", "global=7"}},
+		{"https://example.com/", []string{"global=7"}},
+		{"https://www.bilibili.com/", []string{"domain=1", "secure=4", "global=7"}},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		if got := cookieNames(jar.Cookies(u)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s got: %v, except: %v", test.url, got, test.want)
+		}
+	}
+}
+
+func TestJarOverride(t *testing.T) {
+	jar := NewJar()
+	u, _ := url.Parse("https://api.bilibili.com/x/member/web/account")
+	jar.Set("SESSDATA", "old")
+	//响应中的 cookie 覆盖手动设置的
+	jar.SetCookies(u, []*http.Cookie{{Name: "SESSDATA", Value: "new", Domain: ".bilibili.com", Path: "/"}})
+	if got := cookieNames(jar.Cookies(u)); !reflect.DeepEqual(got, []string{"SESSDATA=new"}) {
+		t.Errorf("got: %v", got)
+	}
+	//手动设置的覆盖响应中的
+	jar.Set("SESSDATA", "manual")
+	if got := jar.Values(); !reflect.DeepEqual(got, map[string]string{"SESSDATA": "manual"}) {
+		t.Errorf("got: %v", got)
+	}
+	//按域名设置的与响应中同域名同路径的相互覆盖，并且替换同名的全局 cookie
+	jar.SetDomain(".bilibili.com", "SESSDATA", "scoped")
+	jar.SetCookies(u, []*http.Cookie{{Name: "bili_jct", Value: "csrf", Domain: "bilibili.com", Path: "/"}})
+	jar.SetDomain("bilibili.com", "bili_jct", "manual")
+	if got := jar.All(); len(got) != 2 || got[0].Domain != "bilibili.com" || got[0].HostOnly {
+		t.Errorf("got: %+v", got)
+	}
+	other, _ := url.Parse("https://example.com/")
+	if got := jar.Cookies(other); len(got) != 0 {
+		t.Errorf("example.com got: %v", cookieNames(got))
+	}
+	jar.SetCookies(u, []*http.Cookie{{Name: "bili_jct", Domain: "bilibili.com", Path: "/", MaxAge: -1}})
+	if got := jar.Values(); !reflect.DeepEqual(got, map[string]string{"SESSDATA": "scoped"}) {
+		t.Errorf("got: %v", got)
+	}
+	//过期时删除
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "a", Value: "1", Domain: "bilibili.com", Path: "/"},
+		{Name: "b", Value: "2", Domain: "bilibili.com", Path: "/", MaxAge: 1},
+	})
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "a", Domain: "bilibili.com", Path: "/", MaxAge: -1},
+		{Name: "b", Domain: "bilibili.com", Path: "/", Expires: time.Unix(1, 0)},
+	})
+	if got := jar.Values(); len(got) != 1 {
+		t.Errorf("got: %v", got)
+	}
+}
+
+func TestJarJSON(t *testing.T) {
+	jar := NewJar()
+	u, _ := url.Parse("https://www.bilibili.com/")
+	jar.Set("bili_jct", "csrf")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "buvid3", Value: "abc", Domain: ".bilibili.com", Path: "/", MaxAge: 3600},
+		{Name: "session", Value: "s"},
+	})
+	data, err := json.Marshal(jar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewJar()
+	if err = json.Unmarshal(data, loaded); err != nil {
+		t.Fatal(err)
+	}
+	got, want := loaded.All(), jar.All()
+	if len(got) != len(want) {
+		t.Fatalf("got: %v, except: %v", got, want)
+	}
+	for i := range got {
+		if got[i].id() != want[i].id() || got[i].Value != want[i].Value || !got[i].Expires.Equal(want[i].Expires) {
+			t.Errorf("got: %+v, except: %+v", got[i], want[i])
+		}
+	}
+	//快照不影响 jar
+	all := jar.All()
+	all[0].Value = "changed"
+	if jar.All()[0].Value == "changed" {
+		t.Error("All() returned a reference to the jar")
+	}
+}
+
+func TestClientCookie(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("SESSDATA"); err != nil || c.Value != "sess" {
+			t.Errorf("request cookie: %v", r.Cookies())
+		}
+		http.SetCookie(w, &http.Cookie{Name: "bili_jct", Value: "new"})
+	}))
+	defer server.Close()
+	client := New(nil, map[string]string{"SESSDATA": "sess", "bili_jct": "old"}, 3)
+	if _, err := client.Get(server.URL, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	cookie := client.Cookie()
+	want := map[string]string{"SESSDATA": "sess", "bili_jct": "new"}
+	if !reflect.DeepEqual(cookie, want) {
+		t.Errorf("got: %v, except: %v", cookie, want)
+	}
+	cookie["SESSDATA"] = "changed"
+	if client.Cookie()["SESSDATA"] != "sess" {
+		t.Error("Cookie() returned a reference to the client's cookie")
+	}
+}
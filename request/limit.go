@@ -0,0 +1,119 @@
+package request
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrClosed Client 已经关闭
+	ErrClosed = errors.New("client closed")
+	// LimitCodes 表示请求过于频繁的错误码，响应中出现这些错误码时退避
+	//-412：请求被拦截，-509：请求过于频繁，12015：需要输入验证码
+	LimitCodes = []int64{-412, -509, 12015}
+)
+
+const (
+	backoffBase = 5 * time.Second //第一次退避的时间
+	backoffMax  = 5 * time.Minute //退避时间的上限
+)
+
+// Limit 令牌桶的配置
+type Limit struct {
+	Rate  float64 //每秒产生的令牌数，即每秒最多请求的次数
+	Burst int     //令牌桶的容量，即短时间内最多连续请求的次数
+}
+
+//令牌桶限流器
+type limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64   //当前的令牌数，可能为负数，表示已经预定的令牌
+	last   time.Time //上一次更新令牌数的时间
+	lock   sync.Mutex
+}
+
+func newLimiter(l Limit) *limiter {
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{
+		rate:   l.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+//预定一个令牌，返回需要等待的时间
+func (l *limiter) reserve(now time.Time) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.rate <= 0 {
+		return 0
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+//指数退避，连续出现请求过于频繁时，退避时间翻倍，请求成功后逐步恢复
+type backoff struct {
+	level int       //连续退避的次数
+	until time.Time //在此时间之前不发送请求
+	lock  sync.Mutex
+}
+
+//需要等待的时间
+func (b *backoff) wait(now time.Time) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if now.Before(b.until) {
+		return b.until.Sub(now)
+	}
+	return 0
+}
+
+//请求过于频繁，增加退避时间，返回本次退避的时间
+func (b *backoff) fail(now time.Time) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	d := backoffBase << b.level
+	if d > backoffMax || d <= 0 {
+		d = backoffMax
+	} else {
+		b.level++
+	}
+	//随机抖动，避免多个请求同时恢复
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	b.until = now.Add(d)
+	return d
+}
+
+//请求成功，每次成功减少一级退避
+func (b *backoff) ok() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.level > 0 {
+		b.level--
+	}
+}
+
+func isLimitCode(code int64) bool {
+	for _, c := range LimitCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
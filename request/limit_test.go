@@ -0,0 +1,78 @@
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(Limit{Rate: 2, Burst: 2})
+	now := l.last
+	//令牌桶满时可以连续请求 burst 次
+	for i := 0; i < 2; i++ {
+		if d := l.reserve(now); d != 0 {
+			t.Fatalf("reserve %d: wait %v", i, d)
+		}
+	}
+	if d := l.reserve(now); d != 500*time.Millisecond {
+		t.Errorf("got: %v, except: %v", d, 500*time.Millisecond)
+	}
+	//预定的令牌需要继续等待
+	if d := l.reserve(now); d != time.Second {
+		t.Errorf("got: %v, except: %v", d, time.Second)
+	}
+	if d := l.reserve(now.Add(10 * time.Second)); d != 0 {
+		t.Errorf("got: %v, except: 0", d)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := &backoff{}
+	now := time.Now()
+	var last time.Duration
+	for i := 0; i < 10; i++ {
+		d := b.fail(now)
+		upper := backoffBase << i
+		if upper > backoffMax {
+			upper = backoffMax
+		}
+		if d < upper/2 || d > upper {
+			t.Fatalf("fail %d: %v not in [%v, %v]", i, d, upper/2, upper)
+		}
+		if w := b.wait(now); w != d {
+			t.Fatalf("wait %v, except: %v", w, d)
+		}
+		last = d
+	}
+	if b.wait(now.Add(last)) != 0 {
+		t.Error("should not wait after backoff")
+	}
+	level := b.level
+	b.ok()
+	if b.level != level-1 {
+		t.Errorf("level got: %d, except: %d", b.level, level-1)
+	}
+}
+
+func TestClientBackoff(t *testing.T) {
+	code := "-412"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":` + code + `}`))
+	}))
+	defer server.Close()
+	c := New(map[string]string{}, map[string]string{}, 3)
+	if _, err := c.Get(server.URL, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.backoff.wait(time.Now()) <= 0 {
+		t.Fatal("should back off after -412")
+	}
+	//关闭后不再等待
+	c.Close()
+	if _, err := c.Get(server.URL, nil, nil); err != ErrClosed {
+		t.Errorf("got: %v, except: %v", err, ErrClosed)
+	}
+}
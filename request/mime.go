@@ -5,6 +5,7 @@ import "mime"
 const (
 	ApplicationJson       = "application/json"
 	ApplicationUrlencoded = "application/x-www-form-urlencoded"
+	MultipartFormData     = "multipart/form-data"
 )
 
 type ContentType struct {
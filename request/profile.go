@@ -0,0 +1,89 @@
+package request
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+const (
+	// DefaultProfile 没有指定时使用的请求头配置
+	DefaultProfile = "chrome-win"
+	// RandomProfile 随机选择一个内置的请求头配置，程序运行期间不再改变
+	RandomProfile = "random"
+)
+
+//内置的请求头配置，同一个配置中的 User-Agent 和 Client Hints 对应同一个浏览器，
+//Firefox 不发送 Client Hints
+var profiles = map[string]map[string]string{
+	"chrome-win": {
+		"User-Agent":         "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+		"Accept":             "application/json, text/plain, */*",
+		"Accept-Language":    "zh-CN,zh;q=0.9",
+		"Accept-Encoding":    "gzip, deflate, br",
+		"sec-ch-ua":          `"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"`,
+		"sec-ch-ua-mobile":   "?0",
+		"sec-ch-ua-platform": `"Windows"`,
+	},
+	"chrome-mac": {
+		"User-Agent":         "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+		"Accept":             "application/json, text/plain, */*",
+		"Accept-Language":    "zh-CN,zh;q=0.9",
+		"Accept-Encoding":    "gzip, deflate, br",
+		"sec-ch-ua":          `"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"`,
+		"sec-ch-ua-mobile":   "?0",
+		"sec-ch-ua-platform": `"macOS"`,
+	},
+	"edge-win": {
+		"User-Agent":         "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36 Edg/131.0.0.0",
+		"Accept":             "application/json, text/plain, */*",
+		"Accept-Language":    "zh-CN,zh;q=0.9,en;q=0.8,en-GB;q=0.7,en-US;q=0.6",
+		"Accept-Encoding":    "gzip, deflate, br",
+		"sec-ch-ua":          `"Microsoft Edge";v="131", "Chromium";v="131", "Not_A Brand";v="24"`,
+		"sec-ch-ua-mobile":   "?0",
+		"sec-ch-ua-platform": `"Windows"`,
+	},
+	"firefox-win": {
+		"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:133.0) Gecko/20100101 Firefox/133.0",
+		"Accept":          "application/json, text/plain, */*",
+		"Accept-Language": "zh-CN,zh;q=0.8,zh-TW;q=0.7,zh-HK;q=0.5,en-US;q=0.3,en;q=0.2",
+		"Accept-Encoding": "gzip, deflate, br",
+	},
+}
+
+// Profiles 所有内置的请求头配置的名称
+func Profiles() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfileHeader 获取名称为 name 的请求头配置，返回的是副本，name 为空时使用 DefaultProfile，
+//为 RandomProfile 时随机选择一个
+func ProfileHeader(name string) (map[string]string, error) {
+	switch name {
+	case "":
+		name = DefaultProfile
+	case RandomProfile:
+		//使用 crypto/rand，每次运行时选择的配置不同
+		names := Profiles()
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(names))))
+		if err != nil {
+			return nil, fmt.Errorf("随机选择请求头配置失败：%w", err)
+		}
+		name = names[n.Int64()]
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的请求头配置：%s，可选的配置：%v", name, Profiles())
+	}
+	header := make(map[string]string, len(profile))
+	for k, v := range profile {
+		header[k] = v
+	}
+	return header, nil
+}
@@ -0,0 +1,58 @@
+package request
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+//User-Agent 与 Client Hints 中的浏览器版本和平台需要一致
+func TestProfileConsistent(t *testing.T) {
+	uaVersion := regexp.MustCompile(`Chrome/(\d+)\.`)
+	hintVersion := regexp.MustCompile(`"Chromium";v="(\d+)"`)
+	platforms := map[string]string{"Windows NT": `"Windows"`, "Macintosh": `"macOS"`}
+	for _, name := range Profiles() {
+		header, err := ProfileHeader(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ua := header["User-Agent"]
+		hint, ok := header["sec-ch-ua"]
+		if strings.Contains(ua, "Firefox") {
+			if ok {
+				t.Errorf("%s: firefox should not send client hints", name)
+			}
+			continue
+		}
+		v1, v2 := uaVersion.FindStringSubmatch(ua), hintVersion.FindStringSubmatch(hint)
+		if v1 == nil || v2 == nil || v1[1] != v2[1] {
+			t.Errorf("%s: version mismatch, ua=%s, sec-ch-ua=%s", name, ua, hint)
+		}
+		if strings.Contains(ua, "Edg/") != strings.Contains(hint, "Microsoft Edge") {
+			t.Errorf("%s: brand mismatch, ua=%s, sec-ch-ua=%s", name, ua, hint)
+		}
+		for os, platform := range platforms {
+			if strings.Contains(ua, os) && header["sec-ch-ua-platform"] != platform {
+				t.Errorf("%s: platform got: %s, except: %s", name, header["sec-ch-ua-platform"], platform)
+			}
+		}
+	}
+}
+
+func TestProfileHeader(t *testing.T) {
+	header, err := ProfileHeader("")
+	if err != nil || header["User-Agent"] != profiles[DefaultProfile]["User-Agent"] {
+		t.Errorf("default profile got: %v, %v", header, err)
+	}
+	//返回的是副本
+	header["User-Agent"] = "changed"
+	if profiles[DefaultProfile]["User-Agent"] == "changed" {
+		t.Error("ProfileHeader returned the built-in profile")
+	}
+	if _, err = ProfileHeader(RandomProfile); err != nil {
+		t.Error(err)
+	}
+	if _, err = ProfileHeader("ie6"); err == nil {
+		t.Error("unknown profile should return an error")
+	}
+}
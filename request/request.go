@@ -7,9 +7,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/andybalholm/brotli"
+	"github.com/tidwall/gjson"
 	"io"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 )
 
@@ -18,15 +20,47 @@ var (
 	ErrRequest = errors.New("request fail")
 )
 
+// StatusError 响应状态码大于等于400时返回的错误，可以使用 errors.Is(err, ErrRequest) 判断
+type StatusError struct {
+	Status int    //响应状态码
+	Path   string //请求地址的路径
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request fail, status=%d, path=%s", e.Status, e.Path)
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrRequest
+}
+
 type Client struct {
 	header map[string]string
-	cookie map[string]string
+	jar    *Jar
 	client *http.Client
+	lock   sync.RWMutex //多个协程共用同一个 Client 时，保护令牌桶的读写
+	//每次请求结束后调用，path 为请求地址的路径，status 为响应状态码，请求失败时为0
+	observer func(path string, status int, elapsed time.Duration)
+	limits   map[string]*limiter //每个请求路径的令牌桶，键为空字符串的是默认令牌桶
+	wbi      wbiKey              //WBI 签名使用的密钥
+	backoff  backoff             //所有请求共用的退避状态
+	done     chan struct{}       //关闭后不再等待令牌
+	once     sync.Once
 }
 
 // New 根据指定的 header，cookie 和超时时间 timeout 创建一个 Client
 //使用该 Client 发送的网络请求都会使用这里指定的 header 和 cookie
 func New(header map[string]string, cookie map[string]string, timeout int) *Client {
+	jar := NewJar()
+	for name, value := range cookie {
+		jar.Set(name, value)
+	}
+	return NewWithJar(header, jar, timeout)
+}
+
+// NewWithJar 根据指定的 header，cookie jar 和超时时间 timeout 创建一个 Client，
+//响应中设置的 cookie 会保存到 jar 中
+func NewWithJar(header map[string]string, jar *Jar, timeout int) *Client {
 	tr := &http.Transport{
 		MaxIdleConns:        10,
 		MaxIdleConnsPerHost: 4,
@@ -34,17 +68,20 @@ func New(header map[string]string, cookie map[string]string, timeout int) *Clien
 	}
 	c := &http.Client{
 		Transport: tr,
+		Jar:       jar,
 		Timeout:   time.Duration(timeout) * time.Second,
 	}
 	return &Client{
 		header: header,
-		cookie: cookie,
+		jar:    jar,
 		client: c,
+		limits: make(map[string]*limiter),
+		done:   make(chan struct{}),
 	}
 }
 
 //处理响应体数据
-func handleResp(resp *http.Response) (Entity, error) {
+func handleResp(resp *http.Response) (*ByteEntity, error) {
 	//获取响应体长度
 	contentLength := resp.ContentLength
 	//获取响应体数据类型
@@ -104,18 +141,8 @@ func (c *Client) request(method, urlStr string,
 	if err != nil {
 		return nil, err
 	}
-	//设置cookie
+	//cookie 由 jar 设置，响应中设置的 cookie 也会保存到 jar 中
 	u := req.URL
-	for name, value := range c.cookie {
-		cookie := &http.Cookie{
-			Name:   name,
-			Value:  value,
-			Path:   "/",
-			Domain: u.Host,
-			MaxAge: 0,
-		}
-		req.AddCookie(cookie)
-	}
 	//设置header
 	for name, value := range c.header {
 		req.Header.Add(name, value)
@@ -123,24 +150,95 @@ func (c *Client) request(method, urlStr string,
 	if body != nil {
 		req.Header.Add("Content-Type", body.ContentType())
 	}
+	//等待令牌
+	if err = c.wait(u.Path); err != nil {
+		return nil, err
+	}
 	//发送请求
+	start := time.Now()
 	resp, err := c.client.Do(req)
 	if err != nil {
+		c.observe(u.Path, 0, start)
 		return nil, err
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
+	c.observe(u.Path, resp.StatusCode, start)
 
-	if resp.StatusCode >= 400 {
-		return nil, ErrRequest
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		//请求被拦截
+		c.backoff.fail(time.Now())
 	}
-	//如果响应头中带有 cookie，更新现有的 cookie
-	for _, cookie := range resp.Cookies() {
-		c.cookie[cookie.Name] = cookie.Value
+	if resp.StatusCode >= 400 {
+		return nil, &StatusError{Status: resp.StatusCode, Path: u.Path}
 	}
 	//获取响应体的数据
-	return handleResp(resp)
+	entity, err := handleResp(resp)
+	if err != nil {
+		return nil, err
+	}
+	entity.path = u.Path
+	entity.status = resp.StatusCode
+	if entity.contentType != nil && entity.contentType.Type() == ApplicationJson {
+		code := gjson.GetBytes(entity.peek(), "code")
+		if isLimitCode(code.Int()) {
+			c.backoff.fail(time.Now())
+		} else {
+			c.backoff.ok()
+		}
+	}
+	return entity, nil
+}
+
+//等待退避结束，然后从令牌桶中获取令牌
+func (c *Client) wait(path string) error {
+	sleep := func(d time.Duration) error {
+		if d <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return nil
+		case <-c.done:
+			return ErrClosed
+		}
+	}
+	if err := sleep(c.backoff.wait(time.Now())); err != nil {
+		return err
+	}
+	c.lock.RLock()
+	l, ok := c.limits[path]
+	if !ok {
+		l = c.limits[""]
+	}
+	c.lock.RUnlock()
+	if l == nil {
+		return nil
+	}
+	return sleep(l.reserve(time.Now()))
+}
+
+// SetLimit 设置请求路径 path 的令牌桶，path 为空字符串时设置默认的令牌桶，没有单独设置的路径共用默认的令牌桶
+func (c *Client) SetLimit(path string, l Limit) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.limits[path] = newLimiter(l)
+}
+
+// Close 关闭 Client，正在等待令牌或退避的请求会返回 ErrClosed
+func (c *Client) Close() {
+	c.once.Do(func() {
+		close(c.done)
+	})
+}
+
+func (c *Client) observe(path string, status int, start time.Time) {
+	if c.observer != nil {
+		c.observer(path, status, time.Since(start))
+	}
 }
 
 // Get 发送 GET 请求
@@ -165,17 +263,36 @@ func (c *Client) GetWithRetry(urlStr string, params map[string]interface{},
 	return nil, err
 }
 
-// SetCookie 设置cookie
-func (c *Client) SetCookie(name, value string) {
-	c.cookie[name] = value
+// SetObserver 设置请求结束后的回调，用于统计请求耗时，需要在发送请求前设置
+func (c *Client) SetObserver(observer func(path string, status int, elapsed time.Duration)) {
+	c.observer = observer
+}
+
+// SetCookie 设置cookie，该 cookie 会发送给 domain 及其子域名，domain 为空时发送给所有域名
+func (c *Client) SetCookie(domain, name, value string) {
+	if domain == "" {
+		c.jar.Set(name, value)
+		return
+	}
+	c.jar.SetDomain(domain, name, value)
 }
 
 // Cookie 获取cookie,返回的 cookie 为 client 持有的 cookie 的副本，
 //对其进行修改不会影响 client 持有的 cookie 的内容
 func (c *Client) Cookie() map[string]string {
-	back := make(map[string]string)
-	for k, v := range back {
-		back[k] = v
+	return c.jar.Values()
+}
+
+// Header 获取 client 使用的请求头的副本
+func (c *Client) Header() map[string]string {
+	header := make(map[string]string, len(c.header))
+	for k, v := range c.header {
+		header[k] = v
 	}
-	return back
+	return header
+}
+
+// Jar 获取 client 使用的 cookie jar
+func (c *Client) Jar() *Jar {
+	return c.jar
 }
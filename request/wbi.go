@@ -0,0 +1,130 @@
+package request
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+//获取 WBI 签名密钥的接口地址，测试时替换为本地的服务
+var navURL = "https://api.bilibili.com/x/web-interface/nav"
+
+const (
+	wbiKeyTTL  = time.Hour //密钥的缓存时间，密钥每天更新一次
+	wbiBadSign = -352      //签名校验失败时响应中的 code
+)
+
+//将 img_key 和 sub_key 拼接后按照该表重新排列，取前32个字符作为签名时使用的 mixin key，
+//参考自：https://github.com/SocialSisterYi/bilibili-API-collect/blob/master/docs/misc/sign/wbi.md
+var mixinKeyEncTab = []int{
+	46, 47, 18, 2, 53, 8, 23, 32, 15, 50, 10, 31, 58, 3, 45, 35, 27, 43, 5, 49,
+	33, 9, 42, 19, 29, 28, 14, 39, 12, 38, 41, 13, 37, 48, 7, 16, 24, 55, 40,
+	61, 26, 17, 0, 1, 60, 51, 30, 4, 22, 25, 54, 21, 56, 59, 6, 63, 57, 62, 11,
+	36, 20, 34, 44, 52,
+}
+
+//缓存的 WBI 签名密钥
+type wbiKey struct {
+	lock    sync.Mutex
+	mixin   string
+	fetched time.Time //获取密钥的时间
+}
+
+//根据 img_key 和 sub_key 生成 mixin key
+func mixinKey(imgKey, subKey string) string {
+	raw := imgKey + subKey
+	var sb strings.Builder
+	for _, i := range mixinKeyEncTab {
+		if i < len(raw) {
+			sb.WriteByte(raw[i])
+		}
+	}
+	key := sb.String()
+	if len(key) > 32 {
+		key = key[:32]
+	}
+	return key
+}
+
+// SignWbi 使用 mixin key 对请求参数进行 WBI 签名，返回添加了 wts 和 w_rid 的新参数，不修改 params，
+//参数值中的 !'()* 字符会被去掉
+func SignWbi(params map[string]interface{}, mixin string, now time.Time) map[string]interface{} {
+	signed := make(map[string]interface{}, len(params)+2)
+	for k, v := range params {
+		signed[k] = strings.Map(func(r rune) rune {
+			if strings.ContainsRune("!'()*", r) {
+				return -1
+			}
+			return r
+		}, fmt.Sprintf("%v", v))
+	}
+	signed["wts"] = strconv.FormatInt(now.Unix(), 10)
+	keys := make([]string, 0, len(signed))
+	for k := range signed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	query := make([]string, 0, len(keys))
+	for _, k := range keys {
+		query = append(query, url.QueryEscape(k)+"="+url.QueryEscape(signed[k].(string)))
+	}
+	//空格需要编码为 %20
+	str := strings.ReplaceAll(strings.Join(query, "&"), "+", "%20")
+	sum := md5.Sum([]byte(str + mixin))
+	signed["w_rid"] = hex.EncodeToString(sum[:])
+	return signed
+}
+
+//获取签名使用的 mixin key，缓存过期或者 refresh 为 true 时重新获取
+func (c *Client) wbiMixin(refresh bool) (string, error) {
+	c.wbi.lock.Lock()
+	defer c.wbi.lock.Unlock()
+	if !refresh && c.wbi.mixin != "" && time.Since(c.wbi.fetched) < wbiKeyTTL {
+		return c.wbi.mixin, nil
+	}
+	entity, err := c.Get(navURL, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	//未登录时 code 为 -101，但仍然会返回密钥
+	data := gjson.ParseBytes(entity.(*ByteEntity).peek())
+	imgURL := data.Get("data.wbi_img.img_url").String()
+	subURL := data.Get("data.wbi_img.sub_url").String()
+	if imgURL == "" || subURL == "" {
+		return "", errors.New("获取 WBI 签名密钥失败：" + data.Get("message").String())
+	}
+	key := func(u string) string {
+		name := path.Base(u)
+		return strings.TrimSuffix(name, path.Ext(name))
+	}
+	c.wbi.mixin = mixinKey(key(imgURL), key(subURL))
+	c.wbi.fetched = time.Now()
+	return c.wbi.mixin, nil
+}
+
+// GetWbi 发送需要 WBI 签名的 GET 请求，签名校验失败时重新获取密钥并重试一次
+func (c *Client) GetWbi(urlStr string, params map[string]interface{}, body Entity) (Entity, error) {
+	for i := 0; ; i++ {
+		mixin, err := c.wbiMixin(i > 0)
+		if err != nil {
+			return nil, err
+		}
+		entity, err := c.Get(urlStr, SignWbi(params, mixin, time.Now()), body)
+		if err != nil || i > 0 {
+			return entity, err
+		}
+		if e, ok := entity.(*ByteEntity); !ok || gjson.GetBytes(e.peek(), "code").Int() != wbiBadSign {
+			return entity, nil
+		}
+	}
+}
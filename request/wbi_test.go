@@ -0,0 +1,80 @@
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//测试数据来自：https://github.com/SocialSisterYi/bilibili-API-collect/blob/master/docs/misc/sign/wbi.md
+const (
+	testImgKey = "7cd084941338484aae1ad9425b84077c"
+	testSubKey = "4932caff0ff746eab6f01bf08b70ac45"
+	testMixin  = "ea1db124af3c7062474693fa704f4ff8"
+)
+
+func TestSignWbi(t *testing.T) {
+	if got := mixinKey(testImgKey, testSubKey); got != testMixin {
+		t.Fatalf("mixin key got: %s, except: %s", got, testMixin)
+	}
+	params := map[string]interface{}{"foo": "114", "bar": "514", "zab": 1919810}
+	signed := SignWbi(params, testMixin, time.Unix(1702204169, 0))
+	if signed["wts"] != "1702204169" || signed["w_rid"] != "8f6f2b5b3d485fe1886cec6a0be8c5d4" {
+		t.Errorf("got: %v", signed)
+	}
+	if _, ok := params["w_rid"]; ok {
+		t.Error("SignWbi modified params")
+	}
+	//去掉特殊字符后签名
+	a := SignWbi(map[string]interface{}{"q": "(a!b)"}, testMixin, time.Unix(1, 0))
+	b := SignWbi(map[string]interface{}{"q": "ab"}, testMixin, time.Unix(1, 0))
+	if a["w_rid"] != b["w_rid"] {
+		t.Errorf("got: %v, except: %v", a, b)
+	}
+}
+
+func TestGetWbi(t *testing.T) {
+	navCount, badSign := 0, true
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nav", func(w http.ResponseWriter, r *http.Request) {
+		navCount++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":-101,"message":"账号未登录","data":{"isLogin":false,"wbi_img":{` +
+			`"img_url":"https://i0.hdslb.com/bfs/wbi/` + testImgKey + `.png",` +
+			`"sub_url":"https://i0.hdslb.com/bfs/wbi/` + testSubKey + `.png"}}}`))
+	})
+	mux.HandleFunc("/info", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		wts, _ := strconv.ParseInt(query.Get("wts"), 10, 64)
+		want := SignWbi(map[string]interface{}{"mid": query.Get("mid")}, testMixin, time.Unix(wts, 0))
+		if query.Get("w_rid") != want["w_rid"] {
+			t.Errorf("w_rid got: %s, except: %s", query.Get("w_rid"), want["w_rid"])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		//第一次请求时返回签名错误，模拟密钥过期
+		if badSign {
+			badSign = false
+			_, _ = w.Write([]byte(`{"code":-352,"message":"风控校验失败"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"mid":1}}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	old := navURL
+	navURL = server.URL + "/nav"
+	defer func() { navURL = old }()
+
+	client := New(nil, map[string]string{}, 3)
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetWbi(server.URL+"/info", map[string]interface{}{"mid": 1}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//签名错误时重新获取一次，之后使用缓存的密钥
+	if navCount != 2 {
+		t.Errorf("nav count got: %d, except: 2", navCount)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"text/template"
+	"time"
+
+	"github.com/Hami-Lemon/bobo-bot/set"
+	"github.com/tidwall/gjson"
+)
+
+//没有设置 rules 时使用的默认规则：点赞所有评论，评论包含 test 时反馈延迟，监控的账号发布评论时推送
+const defaultRules = `[
+  {"name": "点赞", "like": true},
+  {"name": "延迟反馈", "msg": "test", "reply": "{{.Delay}}", "cooldown": 180},
+  {"name": "监控账号评论", "monitor": true, "push": "[{{.Time}}]\n{{.Alias}}的评论：{{.Msg}}"}
+]`
+
+// Rule 评论的处理规则，所有条件都满足时匹配该规则，未设置的条件不做限制
+type Rule struct {
+	name     string
+	allow    *set.HashSet[uint64] //只匹配这些用户的评论
+	deny     *set.HashSet[uint64] //不匹配这些用户的评论
+	monitor  bool                 //只匹配监控的账号发布的评论
+	msg      *regexp.Regexp       //匹配评论内容
+	uname    *regexp.Regexp       //匹配用户名
+	minAge   int                  //评论发布时间距今的最小值，单位：秒
+	maxAge   int                  //评论发布时间距今的最大值，单位：秒，为0则不限制
+	like     bool                 //点赞该评论
+	skip     bool                 //不再匹配后续的规则
+	reply    *template.Template   //回复该评论
+	push     *template.Template   //推送消息
+	cooldown int                  //两次回复或推送的最小间隔，单位：秒
+	last     int64                //上一次回复或推送的时间
+}
+
+//渲染回复和推送模板时使用的数据
+type ruleData struct {
+	Board string //评论区名称
+	Alias string //监控账号的别名
+	Uname string //评论的用户名
+	Uid   uint64 //评论的用户uid
+	Msg   string //评论内容
+	Rpid  uint64 //评论id
+	Time  string //评论发布时间，格式为 01-02 15:04:05
+	Delay string //评论的延迟，例如：延迟为 5秒
+}
+
+// RuleSet 一个评论区使用的规则，规则中记录了冷却时间，每个 bot 使用单独的副本
+type RuleSet struct {
+	rules   []Rule
+	board   string
+	monitor Account
+	offset  int //计算延迟时的误差，即获取评论的cd
+}
+
+func newRuleSet(rules []Rule, board string, monitor Account, offset int) *RuleSet {
+	r := &RuleSet{
+		rules:   make([]Rule, len(rules)),
+		board:   board,
+		monitor: monitor,
+		offset:  offset,
+	}
+	copy(r.rules, rules)
+	return r
+}
+
+// Match 按顺序返回 comment 匹配的规则，匹配到 skip 规则时不再匹配后续的规则
+func (r *RuleSet) Match(comment Comment, now time.Time) []*Rule {
+	var matched []*Rule
+	age := int(now.Unix() - int64(comment.ctime))
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if !rule.match(comment, r.monitor.uid, age) {
+			continue
+		}
+		matched = append(matched, rule)
+		if rule.skip {
+			break
+		}
+	}
+	return matched
+}
+
+// Like 匹配的规则中是否有需要点赞的规则
+func (r *RuleSet) Like(comment Comment, now time.Time) bool {
+	for _, rule := range r.Match(comment, now) {
+		if rule.like {
+			return true
+		}
+	}
+	return false
+}
+
+//生成模板数据
+func (r *RuleSet) data(comment Comment, now time.Time) ruleData {
+	delay := int(now.Unix()-int64(comment.ctime)) - r.offset
+	// 因为设定每隔几秒获取一次评论，所以会存在几秒的误差，
+	// 如果计算的延迟小于该间隔时间，则延迟为0
+	if delay < 0 {
+		delay = 0
+	}
+	return ruleData{
+		Board: r.board,
+		Alias: r.monitor.alias,
+		Uname: comment.uname,
+		Uid:   comment.uid,
+		Msg:   comment.msg,
+		Rpid:  comment.replyId,
+		Time:  time.Unix(int64(comment.ctime), 0).Format("01-02 15:04:05"),
+		Delay: delayMsg(delay),
+	}
+}
+
+func (r *Rule) match(comment Comment, monitor uint64, age int) bool {
+	if r.allow != nil && !r.allow.Contains(comment.uid) {
+		return false
+	}
+	if r.deny != nil && r.deny.Contains(comment.uid) {
+		return false
+	}
+	if r.monitor && comment.uid != monitor {
+		return false
+	}
+	if r.msg != nil && !r.msg.MatchString(comment.msg) {
+		return false
+	}
+	if r.uname != nil && !r.uname.MatchString(comment.uname) {
+		return false
+	}
+	if age < r.minAge || (r.maxAge > 0 && age > r.maxAge) {
+		return false
+	}
+	return true
+}
+
+//是否已经过了冷却时间，如果是，则重新开始计时
+func (r *Rule) ready(now time.Time) bool {
+	if r.cooldown > 0 && r.last != 0 && now.Unix()-r.last <= int64(r.cooldown) {
+		return false
+	}
+	r.last = now.Unix()
+	return true
+}
+
+//渲染模板，模板在读取设置时已经校验过，这里忽略错误
+func render(t *template.Template, data ruleData) string {
+	buf := &bytes.Buffer{}
+	_ = t.Execute(buf, data)
+	return buf.String()
+}
+
+//格式化延迟，单位：秒
+func delayMsg(delay int) string {
+	if delay <= 60 {
+		return fmt.Sprintf("延迟为%2d秒", delay)
+	} else if delay <= 60*60 {
+		return fmt.Sprintf("延迟为%d分%02d秒", delay/60, delay%60)
+	}
+	s := delay % 60
+	delay /= 60
+	m, h := delay%60, delay/60
+	return fmt.Sprintf("延迟为%d时%02d分%02d秒", h, m, s)
+}
+
+//读取设置中的规则列表，items 不是数组时使用默认规则
+func parseRules(items gjson.Result) ([]Rule, error) {
+	if !items.IsArray() {
+		items = gjson.Parse(defaultRules)
+	}
+	var rules []Rule
+	for i, item := range items.Array() {
+		rule, err := parseRule(item)
+		if err != nil {
+			return nil, fmt.Errorf("rules[%d]: %w", i, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseRule(item gjson.Result) (Rule, error) {
+	rule := Rule{
+		name:     item.Get("name").String(),
+		monitor:  item.Get("monitor").Bool(),
+		minAge:   int(item.Get("minAge").Int()),
+		maxAge:   int(item.Get("maxAge").Int()),
+		like:     item.Get("like").Bool(),
+		skip:     item.Get("skip").Bool(),
+		cooldown: int(item.Get("cooldown").Int()),
+	}
+	uids := func(key string) *set.HashSet[uint64] {
+		list := item.Get(key)
+		if !list.IsArray() {
+			return nil
+		}
+		s := set.New[uint64]()
+		for _, uid := range list.Array() {
+			s.Add(uid.Uint())
+		}
+		return s
+	}
+	rule.allow = uids("allow")
+	rule.deny = uids("deny")
+	var err error
+	compile := func(key string) *regexp.Regexp {
+		expr := item.Get(key)
+		if err != nil || !expr.Exists() {
+			return nil
+		}
+		var re *regexp.Regexp
+		re, err = regexp.Compile(expr.String())
+		return re
+	}
+	rule.msg = compile("msg")
+	rule.uname = compile("uname")
+	parse := func(key string) *template.Template {
+		text := item.Get(key)
+		if err != nil || !text.Exists() {
+			return nil
+		}
+		var t *template.Template
+		t, err = template.New(key).Option("missingkey=error").Parse(text.String())
+		if err == nil {
+			//使用空数据渲染一次，检查模板中的字段是否存在
+			err = t.Execute(&bytes.Buffer{}, ruleData{})
+		}
+		return t
+	}
+	rule.reply = parse("reply")
+	rule.push = parse("push")
+	return rule, err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestDefaultRules(t *testing.T) {
+	rules, err := parseRules(gjson.Result{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	monitor := Account{uid: 33, alias: "33"}
+	r := newRuleSet(rules, "test", monitor, 5)
+	now := time.Unix(1000, 0)
+	comment := func(uid uint64, msg string) Comment {
+		return Comment{Account: Account{uid: uid, uname: "user"}, msg: msg, ctime: 980}
+	}
+	tests := []struct {
+		name    string
+		comment Comment
+		want    []string
+	}{
+		{"like", comment(1, "hello"), []string{"点赞"}},
+		{"delay", comment(1, "test"), []string{"点赞", "延迟反馈"}},
+		{"monitor", comment(33, "hello"), []string{"点赞", "监控账号评论"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matched := r.Match(test.comment, now)
+			var got []string
+			for _, rule := range matched {
+				got = append(got, rule.name)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("got: %v, except: %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("got: %v, except: %v", got, test.want)
+				}
+			}
+		})
+	}
+	data := r.data(comment(33, "test"), now)
+	if got, want := render(r.rules[1].reply, data), "延迟为15秒"; got != want {
+		t.Errorf("reply got: %s, except: %s", got, want)
+	}
+	want := "[" + time.Unix(980, 0).Format("01-02 15:04:05") + "]\n33的评论：test"
+	if got := render(r.rules[2].push, data); got != want {
+		t.Errorf("push got: %s, except: %s", got, want)
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	rules, err := parseRules(gjson.Parse(`[
+		{"name": "deny", "deny": [1], "uname": "^spam", "skip": true},
+		{"name": "allow", "allow": [1, 2], "msg": "^hi", "minAge": 10, "maxAge": 60, "like": true}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRuleSet(rules, "test", Account{}, 0)
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		name    string
+		comment Comment
+		like    bool
+	}{
+		{"allow", Comment{Account: Account{uid: 1, uname: "spam"}, msg: "hi", ctime: 980}, true},
+		{"skip", Comment{Account: Account{uid: 2, uname: "spam"}, msg: "hi", ctime: 980}, false},
+		{"not allow", Comment{Account: Account{uid: 3}, msg: "hi", ctime: 980}, false},
+		{"msg", Comment{Account: Account{uid: 2}, msg: "hello", ctime: 980}, false},
+		{"too new", Comment{Account: Account{uid: 2}, msg: "hi", ctime: 995}, false},
+		{"too old", Comment{Account: Account{uid: 2}, msg: "hi", ctime: 900}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := r.Like(test.comment, now); got != test.like {
+				t.Errorf("got: %v, except: %v", got, test.like)
+			}
+		})
+	}
+}
+
+func TestRuleCooldown(t *testing.T) {
+	rule := Rule{cooldown: 180}
+	now := time.Unix(1000, 0)
+	if !rule.ready(now) {
+		t.Error("first trigger should be ready")
+	}
+	if rule.ready(now.Add(180 * time.Second)) {
+		t.Error("should not be ready in cooldown")
+	}
+	if !rule.ready(now.Add(181 * time.Second)) {
+		t.Error("should be ready after cooldown")
+	}
+}
+
+func TestParseRuleError(t *testing.T) {
+	for _, s := range []string{`[{"msg": "("}]`, `[{"reply": "{{.Unknown}}"}]`} {
+		if _, err := parseRules(gjson.Parse(s)); err == nil {
+			t.Errorf("%s: except error", s)
+		}
+	}
+}
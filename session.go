@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Hami-Lemon/bobo-bot/logger"
+	"github.com/Hami-Lemon/bobo-bot/request"
+)
+
+// Session 定时检查 bot 账号的登录状态，
+//登录状态失效时暂停点赞、回复和发布动态并推送提醒，设置文件中的 botAccount 更新后自动重新登录，
+//cookie 发生变化时保存到 cookieFile 中
+type Session struct {
+	bili       *BiliBili
+	interval   time.Duration //检查登录状态的间隔
+	modTime    time.Time     //设置文件上一次的修改时间
+	cookieFile string        //保存 cookie 的文件，为空时不保存
+	saved      uint64        //上一次保存时 cookie jar 的版本
+	saveLock   sync.Mutex
+	logger     *logger.Logger
+}
+
+const (
+	reloadInterval  = 10 * time.Second //登录状态失效后检查设置文件是否更新的间隔
+	refreshInterval = 12 * time.Hour   //检查 cookie 是否需要刷新的间隔
+	saveInterval    = time.Minute      //检查 cookie 是否需要保存的间隔
+)
+
+// NewSession 创建 Session，interval 为检查登录状态的间隔，为0则不定时检查，
+//cookieFile 为保存 cookie 的文件，为空时不保存
+func NewSession(bili *BiliBili, interval time.Duration, cookieFile string) *Session {
+	s := &Session{
+		bili:       bili,
+		interval:   interval,
+		cookieFile: cookieFile,
+		logger:     logger.New("Session", logLevel, logDst),
+	}
+	if stat, err := os.Stat(settingFile); err == nil {
+		s.modTime = stat.ModTime()
+	}
+	return s
+}
+
+// Run 开始检查登录状态，直到 stop 被关闭
+func (s *Session) Run(stop <-chan struct{}) {
+	//interval 为0时不定时检查，只根据接口返回的错误判断登录状态
+	var checkTick <-chan time.Time
+	if s.interval > 0 {
+		check := time.NewTicker(s.interval)
+		defer check.Stop()
+		checkTick = check.C
+	}
+	reload := time.NewTicker(reloadInterval)
+	defer reload.Stop()
+	refresh := time.NewTicker(refreshInterval)
+	defer refresh.Stop()
+	save := time.NewTicker(saveInterval)
+	defer save.Stop()
+	s.refresh()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-checkTick:
+			if !s.bili.LoggedIn() {
+				continue
+			}
+			err := s.bili.CheckSession()
+			if err != nil && !errors.Is(err, ErrNotLogin) {
+				//网络错误等，不能确定登录状态
+				s.logger.Warn("检查登录状态失败，%v", err)
+			}
+		case <-s.bili.Expired():
+			s.logger.Error("登录状态失效，暂停点赞、回复和发布动态，更新设置文件中的 botAccount 后自动恢复")
+			pushAndLog(s.logger, "bot 账号登录状态失效，已暂停点赞、回复和发布动态，请更新 %s 中的 botAccount", settingFile)
+		case <-save.C:
+			s.SaveCookies()
+		case <-refresh.C:
+			if s.bili.LoggedIn() {
+				s.refresh()
+			}
+		case <-reload.C:
+			if s.bili.LoggedIn() {
+				continue
+			}
+			s.reload()
+		}
+	}
+}
+
+//检查 cookie 是否需要刷新，需要时刷新并写入设置文件
+func (s *Session) refresh() {
+	ok, err := s.bili.RefreshCookie()
+	switch {
+	case errors.Is(err, ErrNoRefreshToken):
+		s.logger.Debug("没有 refresh_token，不刷新 cookie")
+	case err != nil:
+		s.logger.Error("刷新 cookie 失败，%v", err)
+		pushAndLog(s.logger, "刷新 cookie 失败，%v", err)
+	case ok:
+		s.logger.Info("cookie 已刷新，新的 cookie 已写入 %s", settingFile)
+		//设置文件由自己写入，不需要重新读取
+		if stat, err := os.Stat(settingFile); err == nil {
+			s.modTime = stat.ModTime()
+		}
+	default:
+		s.logger.Debug("cookie 不需要刷新")
+	}
+}
+
+// SaveCookies cookie 发生变化时保存到 cookieFile 中，服务器更新的 cookie 在重启后仍然有效
+func (s *Session) SaveCookies() {
+	if s.cookieFile == "" {
+		return
+	}
+	s.saveLock.Lock()
+	defer s.saveLock.Unlock()
+	jar := s.bili.client.Jar()
+	version := jar.Version()
+	if version == s.saved {
+		return
+	}
+	if err := saveCookies(s.cookieFile, jar); err != nil {
+		s.logger.Error("保存 cookie 失败，%v", err)
+		return
+	}
+	s.saved = version
+}
+
+//设置文件更新后重新读取 botAccount 并检查登录状态
+func (s *Session) reload() {
+	stat, err := os.Stat(settingFile)
+	if err != nil || !stat.ModTime().After(s.modTime) {
+		return
+	}
+	s.modTime = stat.ModTime()
+	setting, err := loadSetting()
+	if err != nil {
+		s.logger.Error("读取设置失败，%v", err)
+		return
+	}
+	s.bili.SetAccount(readBotAccount(setting))
+	if err = s.bili.CheckSession(); err != nil {
+		s.logger.Error("设置文件已更新，但仍无法登录，%v", err)
+		return
+	}
+	s.logger.Info("重新登录成功，%s", s.bili.User().uname)
+	pushAndLog(s.logger, "bot 账号重新登录成功：%s，已恢复点赞、回复和发布动态", s.bili.User().uname)
+}
+
+//读取 file 中保存的 cookie，file 比设置文件更新时，使用其中的 cookie 作为登录账号的 cookie，
+//否则登录相关的 cookie 以设置文件中的 botAccount 为准
+func loadCookies(file string, user BotAccount) (*request.Jar, BotAccount) {
+	jar := request.NewJar()
+	if file == "" {
+		return jar, user
+	}
+	stat, err := os.Stat(file)
+	if err != nil {
+		return jar, user
+	}
+	data, err := os.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(data, jar)
+	}
+	if err != nil {
+		mainLogger.Warn("读取保存的 cookie 失败，%v", err)
+		return request.NewJar(), user
+	}
+	if setting, err := os.Stat(settingFile); err == nil && setting.ModTime().After(stat.ModTime()) {
+		return jar, user
+	}
+	acc, err := accountFromCookie(jar.Values())
+	if err != nil || acc.uid != user.uid {
+		//保存的是其它账号的 cookie
+		return jar, user
+	}
+	acc.Account = user.Account
+	acc.refreshToken = user.refreshToken
+	return jar, acc
+}
+
+//将 cookie 写入 file 中
+func saveCookies(file string, jar *request.Jar) error {
+	data, err := json.MarshalIndent(jar, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, data)
+}
@@ -56,3 +56,12 @@ func (h *HashSet[T]) Contains(item ...T) bool {
 func (h *HashSet[T]) Len() int {
 	return len(h.items)
 }
+
+// Slice 获取集合中的所有元素，元素的顺序是不确定的
+func (h *HashSet[T]) Slice() []T {
+	s := make([]T, 0, len(h.items))
+	for e := range h.items {
+		s = append(s, e)
+	}
+	return s
+}
@@ -103,3 +103,26 @@ func TestHashSet_Len(t *testing.T) {
 		})
 	}
 }
+
+func TestHashSet_Slice(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"slice 0", 0},
+		{"slice 1", 1},
+		{"slice 10", 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set := newSet(test.size)
+			s := set.Slice()
+			if len(s) != test.size {
+				t.Errorf("got: %v, except: %v", len(s), test.size)
+			}
+			if !set.Contains(s...) {
+				t.Errorf("slice %v not in set", s)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// Store 保存评论、粉丝数、动态、个人资料修改、统计数据的检查点以及数据汇总，
+//默认使用 sqlite3 数据库，多个 bot 共享数据时可以使用 PostgreSQL 数据库
+type Store interface {
+	// InsertComment 保存评论，fetchTime 为获取到该评论的时间，评论已经存在时只更新用户名、点赞数、回复数和删除标记
+	InsertComment(comment Comment, fetchTime int64)
+	// UpdateLike 更新评论的点赞状态，err 为点赞失败或者没有加入任务队列的原因
+	UpdateLike(comment Comment, status string, err error, now int64)
+	// RetryLikes 获取评论区 oid 中需要重新点赞并且没有被删除的评论，并增加其重试次数
+	RetryLikes(oid uint64, before, since int64, maxRetry, limit int) []Comment
+	// NewestComment 获取评论区 oid 中最新的一条评论（不含楼中楼）的 rpid 和发布时间
+	NewestComment(oid uint64) (uint64, uint64, bool)
+	// InsertFollower 保存账号 uid 的粉丝数
+	InsertFollower(uid uint64, ctime int64, fans int)
+	// InsertDynamic 保存账号 uid 发布的动态，返回该动态之前是否不存在
+	InsertDynamic(uid uint64, dynamic Dynamic, ctime int64) bool
+	// LastProfile 获取账号 uid 每个个人资料字段最近一次记录的值，键为字段名
+	LastProfile(uid uint64) map[string]string
+	// InsertProfileChange 记录账号 uid 个人资料的修改
+	InsertProfileChange(uid uint64, change profileChange, ctime int64)
+	// SaveCheckpoint 保存评论区 oid 的检查点，只保留最新的检查点
+	SaveCheckpoint(oid uint64, ctime int64, data []byte)
+	// LoadCheckpoint 获取评论区 oid 最新的检查点
+	LoadCheckpoint(oid uint64) (int64, []byte, bool)
+	// SaveSummary 保存评论区 oid 的数据汇总，data 为 json 格式的汇总数据
+	SaveSummary(oid uint64, ctime int64, data []byte)
+	// Flush 等待之前的数据全部保存
+	Flush()
+	// Close 保存剩余的数据后关闭
+	Close()
+}
+
+//不同数据库之间的差异，语句中统一使用 ? 作为占位符
+type dialect struct {
+	driver     string             //database/sql 中注册的驱动名称
+	migrations func() []migration //数据库结构的修改步骤
+	legacy     string             //查询是否存在引入版本之前创建的 comment 表，为空表示没有旧版本的数据库
+	numbered   bool               //占位符为 $1, $2 ...
+	lock       string             //升级数据库时在事务中获取锁的语句，为空表示不需要
+}
+
+var (
+	sqliteDialect = dialect{
+		driver:     "sqlite3",
+		migrations: func() []migration { return migrations },
+		legacy:     `select count(*) from sqlite_master where type = 'table' and name = 'comment'`,
+	}
+	postgresDialect = dialect{
+		driver:     "postgres",
+		migrations: func() []migration { return pgMigrations },
+		numbered:   true,
+		//多个程序共享同一个数据库时，同时启动的程序依次升级，锁在事务结束时释放
+		lock: `select pg_advisory_xact_lock(6647041183541510464)`,
+	}
+	//可以使用的数据库，键为设置中的 dbdriver
+	dialects = map[string]dialect{
+		"sqlite3":  sqliteDialect,
+		"postgres": postgresDialect,
+	}
+)
+
+//将语句中的 ? 替换为数据库使用的占位符，字符串中的 ? 不替换
+func (d dialect) bind(query string) string {
+	if !d.numbered || !strings.Contains(query, "?") {
+		return query
+	}
+	var (
+		b      strings.Builder
+		n      int
+		quoted bool
+	)
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// OpenStore 连接 driver 类型的数据库，driver 为空时使用 sqlite3，
+//source 为 sqlite3 的数据库文件名或者 PostgreSQL 的连接字符串，连接失败时返回 nil
+func OpenStore(driver, source string) Store {
+	if driver == "" {
+		driver = sqliteDialect.driver
+	}
+	dia, ok := dialects[driver]
+	if !ok {
+		mainLogger.Error("不支持的数据库：%s，可选的值：sqlite3、postgres", driver)
+		return nil
+	}
+	d := openDB(dia, source)
+	if d == nil {
+		return nil
+	}
+	return d
+}